@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"time"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	config "github.com/msaf1980/godownloader/config/godownloader"
 	"github.com/msaf1980/godownloader/pkg/downloader"
@@ -11,6 +15,113 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+func setAuth(d *downloader.Downloader, cfg *config.Config) error {
+	auth := make([]downloader.Auth, len(cfg.Auth))
+	for i := range cfg.Auth {
+		var err error
+		if auth[i], err = cfg.Auth[i].Auth(); err != nil {
+			return err
+		}
+	}
+	if err := d.SetAuth(auth); err != nil {
+		return err
+	}
+	if cfg.LoginForm != nil {
+		form, err := cfg.LoginForm.LoginForm()
+		if err != nil {
+			return err
+		}
+		d.SetLoginForm(form)
+	}
+	return nil
+}
+
+func setFilters(d *downloader.Downloader, u *config.URL) error {
+	accept, err := u.Accept.Filters()
+	if err != nil {
+		return err
+	}
+	reject, err := u.Reject.Filters()
+	if err != nil {
+		return err
+	}
+	return d.SetURLFilters(u.URL, accept, reject)
+}
+
+// signalContext return context, canceled on SIGINT/SIGTERM (second signal force exit)
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Warn().Str("signal", sig.String()).Msg("shutdown, send signal again for force exit")
+		cancel()
+		sig = <-sigs
+		log.Error().Str("signal", sig.String()).Msg("force exit")
+		os.Exit(1)
+	}()
+	return ctx
+}
+
+// report regenerate run report from existing map
+func report(dir string, saveMode downloader.SaveMode, cfg *config.Config) {
+	d := downloader.NewDownloader(saveMode, cfg.Retry, cfg.Timeout, cfg.MaxRedirects).
+		SetCanonicalizer(cfg.Canonical.Canonicalizer())
+	for i := range cfg.Urls {
+		d.AddRootURL(cfg.Urls[i].URL, cfg.Urls[i].Level, cfg.Urls[i].DownLevel, cfg.Urls[i].ExtLevel)
+	}
+	_, err := d.ReportLoad(dir, config.MAP_FILE)
+	if err == nil {
+		err = d.SaveReport()
+	}
+	if err == nil && len(cfg.Graph) > 0 {
+		err = saveGraph(d, cfg.Graph)
+	}
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	totals := d.Report().Totals
+	log.Info().Int("tasks", totals.Tasks).Int("ok", totals.OK).Int("not_found", totals.NotFound).
+		Int("skipped", totals.Skipped).Int("skipped_level", totals.SkippedLevel).Int("skipped_filter", totals.SkippedFilter).
+		Int("failed", totals.Failed).Int("new", totals.New).Msg("report")
+}
+
+// saveGraph write link graph to file (DOT for .dot or .gv extension, JSON else)
+func saveGraph(d *downloader.Downloader, fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	g := d.Graph()
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".dot", ".gv":
+		err = g.WriteDOT(f)
+	default:
+		err = g.WriteJSON(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// printBrokenLinks print broken links with referenced pages to stdout
+func printBrokenLinks(links []downloader.BrokenLink) {
+	for _, link := range links {
+		if len(link.Referrer) == 0 {
+			// root url
+			fmt.Printf("%s: %s\n", link.URL, link.Err.Error())
+		} else {
+			tag := link.Tag
+			if len(link.Attr) > 0 {
+				tag += " " + link.Attr
+			}
+			fmt.Printf("%s: <%s> %s: %s\n", link.Referrer, tag, link.URL, link.Err.Error())
+		}
+	}
+}
+
 func main() {
 	dir, logLevel, cfg, err := config.Configuration(os.Args)
 	if err != nil {
@@ -26,11 +137,59 @@ func main() {
 
 	zerolog.SetGlobalLevel(logLevel)
 
-	d := downloader.NewDownloader(saveMode, cfg.Retry, cfg.Timeout, cfg.MaxRedirects)
+	if os.Args[1] == "report" {
+		report(dir, saveMode, cfg)
+		return
+	}
+
+	var prog *progress
+	if !cfg.NoProgress && isTerminal(os.Stderr) {
+		// log lines printed above progress
+		prog = newProgress(os.Stderr)
+		log.Logger = log.Output(prog)
+	}
+
+	d := downloader.NewDownloader(saveMode, cfg.Retry, cfg.Timeout, cfg.MaxRedirects).
+		SetUserAgent(cfg.UserAgent).
+		SetIgnoreRobots(cfg.IgnoreRobots).
+		SetConvertLinks(cfg.ConvertLinks).
+		SetCanonicalizer(cfg.Canonical.Canonicalizer()).
+		SetHostLimits(cfg.HostLimits.Limits()).
+		SetRoundRobin(cfg.RoundRobin)
+	httpConfig, err := cfg.HTTP.HTTPConfig()
+	if err == nil {
+		err = d.SetHTTPConfig(httpConfig)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+	if err = d.SetQuotas(cfg.Quotas.Quotas()); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+	if err = setAuth(d, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
 	for i := range cfg.Urls {
+		if cfg.Urls[i].HostLimits != nil {
+			d.SetURLHostLimits(cfg.Urls[i].URL, cfg.Urls[i].HostLimits.Limits())
+		}
 		if !d.AddRootURL(cfg.Urls[i].URL, cfg.Urls[i].Level, cfg.Urls[i].DownLevel, cfg.Urls[i].ExtLevel) {
 			log.Fatal().Str("url", cfg.Urls[i].URL).Msg("already added")
 		}
+		if err = setFilters(d, &cfg.Urls[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// import cookies before resume saved session (saved session cookies is newer)
+	if len(cfg.Cookies) > 0 {
+		if err = d.LoadCookies(cfg.Cookies); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
 	}
 
 	switch os.Args[1] {
@@ -41,6 +200,10 @@ func main() {
 		}
 	case "continue":
 		_, err = d.ExistingLoad(dir, config.MAP_FILE)
+	case "update":
+		_, err = d.UpdateLoad(dir, config.MAP_FILE)
+	case "check":
+		_, err = d.CheckLoad()
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: '%s'\n", os.Args[1])
 		os.Exit(1)
@@ -48,14 +211,30 @@ func main() {
 	if err != nil {
 		log.Fatal().Msg(err.Error())
 	}
-	d.Start(cfg.Parallel)
-	time.Sleep(10 * time.Millisecond)
-	if d.Wait() {
-		log.Error().Msg("Exit with errors")
+	if prog != nil {
+		prog.Start(d)
+	}
+	stats, err := d.SetParallel(cfg.Parallel).Run(signalContext())
+	if prog != nil {
+		prog.Stop()
+	}
+	log.Info().Int64("done", stats.Done).Int64("not_modified", stats.NotModified).Int64("skipped", stats.Skipped).
+		Int64("not_found", stats.NotFound).Int64("failed", stats.Failed).Int64("bytes", stats.Bytes).
+		Dur("duration", stats.Duration).Msg("stats")
+	if len(cfg.Graph) > 0 {
+		if gerr := saveGraph(d, cfg.Graph); gerr != nil {
+			log.Error().Str("graph", cfg.Graph).Msg(gerr.Error())
+			if err == nil {
+				err = gerr
+			}
+		}
+	}
+	if os.Args[1] == "check" {
+		printBrokenLinks(d.BrokenLinks())
+	}
+	if err != nil {
+		log.Error().Msg("Exit with errors: " + err.Error())
 		os.Exit(1)
-	} else {
-		log.Info().Msg("Exit")
-		os.Exit(0)
 	}
-
+	log.Info().Msg("Exit")
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/msaf1980/godownloader/pkg/downloader"
+)
+
+const (
+	progressInterval = 500 * time.Millisecond
+	progressURLWidth = 72 // fit in 80 columns terminal
+)
+
+// isTerminal check for file is a terminal (character device)
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// formatBytes format size with binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDuration format duration as [H:]MM:SS
+func formatDuration(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+func shortURL(url string) string {
+	if len(url) > progressURLWidth {
+		return url[:progressURLWidth-3] + "..."
+	}
+	return url
+}
+
+// progress live progress display on terminal (log lines are printed above it)
+type progress struct {
+	lock  sync.Mutex
+	out   *os.File
+	d     *downloader.Downloader
+	lines int // lines of last drawn progress
+
+	lastBytes int64
+	lastTime  time.Time
+	rate      float64 // bytes per second
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newProgress(out *os.File) *progress {
+	return &progress{out: out, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Write print log line above progress
+func (p *progress) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p._clear()
+	n, err := p.out.Write(b)
+	p._draw()
+	return n, err
+}
+
+// Start periodic redraw progress for downloader
+func (p *progress) Start(d *downloader.Downloader) {
+	p.lock.Lock()
+	p.d = d
+	p.lastTime = time.Now()
+	p.lock.Unlock()
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				p.lock.Lock()
+				p._clear()
+				p.lock.Unlock()
+				return
+			case <-ticker.C:
+				p.lock.Lock()
+				p._clear()
+				p._draw()
+				p.lock.Unlock()
+			}
+		}
+	}()
+}
+
+// Stop stop redraw and clear progress
+func (p *progress) Stop() {
+	close(p.stop)
+	<-p.done
+	p.lock.Lock()
+	p.d = nil
+	p.lock.Unlock()
+}
+
+// internal method, need lock before
+func (p *progress) _clear() {
+	if p.lines > 0 {
+		// move cursor up and clear to end of screen
+		fmt.Fprintf(p.out, "\033[%dA\033[J", p.lines)
+		p.lines = 0
+	}
+}
+
+// internal method, need lock before
+func (p *progress) _draw() {
+	if p.d == nil {
+		return
+	}
+	pr := p.d.Progress()
+
+	now := time.Now()
+	if elapsed := now.Sub(p.lastTime).Seconds(); elapsed >= progressInterval.Seconds()/2 {
+		p.rate = float64(pr.Bytes-p.lastBytes) / elapsed
+		p.lastBytes = pr.Bytes
+		p.lastTime = now
+	}
+
+	finished := pr.Done + pr.NotModified + pr.Skipped + pr.NotFound + pr.Failed
+	eta := "--:--"
+	if finished > 0 && pr.Duration > 0 {
+		perTask := pr.Duration / time.Duration(finished)
+		eta = formatDuration(perTask * time.Duration(pr.Queued+pr.Active))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "queued %d  active %d  done %d  failed %d  not found %d  skipped %d\n",
+		pr.Queued, pr.Active, pr.Done+pr.NotModified, pr.Failed, pr.NotFound, pr.Skipped)
+	fmt.Fprintf(&sb, "%s  %s/s  elapsed %s  ETA %s\n",
+		formatBytes(pr.Bytes), formatBytes(int64(p.rate)), formatDuration(pr.Duration), eta)
+	for i, url := range pr.Workers {
+		if len(url) == 0 {
+			url = "idle"
+		}
+		fmt.Fprintf(&sb, "  #%d %s\n", i, shortURL(url))
+	}
+	p.lines = 2 + len(pr.Workers)
+	_, _ = p.out.WriteString(sb.String())
+}
@@ -4,12 +4,14 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/msaf1980/godownloader/pkg/downloader"
+	"github.com/msaf1980/godownloader/pkg/urlutils"
 	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v2"
 )
@@ -19,11 +21,313 @@ const (
 	MAP_FILE    = "godownloader.map"
 )
 
+// HostLimits per host politeness limits
+type HostLimits struct {
+	Rate     float64 `yaml:"rate"`      // requests per second (0 for unlimited)
+	Burst    int     `yaml:"burst"`     // max burst requests for rate limit
+	MaxConns int     `yaml:"max_conns"` // max concurrent requests (0 for unlimited)
+}
+
+// Limits convert to downloader limits
+func (l *HostLimits) Limits() downloader.HostLimits {
+	return downloader.HostLimits{Rate: l.Rate, Burst: l.Burst, MaxConns: l.MaxConns}
+}
+
+// HTTP http client settings
+type HTTP struct {
+	MaxIdleConns        int               `yaml:"max_idle_conns"`          // max idle (keep-alive) connections (0 for unlimited)
+	MaxIdleConnsPerHost int               `yaml:"max_idle_conns_per_host"` // max idle (keep-alive) connections per host
+	MaxConnsPerHost     int               `yaml:"max_conns_per_host"`      // max connections per host (0 for unlimited)
+	IdleConnTimeout     time.Duration     `yaml:"idle_conn_timeout"`
+	DisableKeepAlives   bool              `yaml:"disable_keep_alives"`
+	HTTP2               bool              `yaml:"http2"`
+	Proxy               string            `yaml:"proxy"` // proxy url (http://, https:// or socks5://), env or blank for direct connections
+	CACert              string            `yaml:"ca_cert"`
+	InsecureSkipVerify  bool              `yaml:"insecure_skip_verify"`
+	ClientCert          string            `yaml:"client_cert"`
+	ClientKey           string            `yaml:"client_key"`
+	Headers             map[string]string `yaml:"-"`                     // not saved (may contain credentials)
+	HeadersEnv          map[string]string `yaml:"headers_env,omitempty"` // header name -> environment variable
+}
+
+// HTTPConfig convert to downloader http client settings
+func (h *HTTP) HTTPConfig() (downloader.HTTPConfig, error) {
+	headers := make(map[string]string, len(h.Headers)+len(h.HeadersEnv))
+	for k, v := range h.Headers {
+		headers[k] = v
+	}
+	for k, env := range h.HeadersEnv {
+		v, err := envValue("", env)
+		if err != nil {
+			return downloader.HTTPConfig{}, err
+		}
+		headers[k] = v
+	}
+	return downloader.HTTPConfig{
+		MaxIdleConns:        h.MaxIdleConns,
+		MaxIdleConnsPerHost: h.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     h.MaxConnsPerHost,
+		IdleConnTimeout:     h.IdleConnTimeout,
+		DisableKeepAlives:   h.DisableKeepAlives,
+		HTTP2:               h.HTTP2,
+		Proxy:               h.Proxy,
+		CACert:              h.CACert,
+		InsecureSkipVerify:  h.InsecureSkipVerify,
+		ClientCert:          h.ClientCert,
+		ClientKey:           h.ClientKey,
+		Headers:             headers,
+	}, nil
+}
+
+// Headers request headers flag ('Name: value')
+type Headers map[string]string
+
+func (h *Headers) Set(value string) error {
+	i := strings.Index(value, ":")
+	if i < 1 {
+		return fmt.Errorf("header must have format 'Name: value': '%s'", value)
+	}
+	if *h == nil {
+		*h = make(map[string]string)
+	}
+	(*h)[strings.TrimSpace(value[0:i])] = strings.TrimSpace(value[i+1:])
+	return nil
+}
+
+func (h *Headers) String() string {
+	return fmt.Sprintf("%v", map[string]string(*h))
+}
+
+// Fields form fields flag ('name=value')
+type Fields map[string]string
+
+func (f *Fields) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i < 1 {
+		return fmt.Errorf("field must have format 'name=value': '%s'", value)
+	}
+	if *f == nil {
+		*f = make(map[string]string)
+	}
+	(*f)[value[0:i]] = value[i+1:]
+	return nil
+}
+
+func (f *Fields) String() string {
+	return fmt.Sprintf("%v", map[string]string(*f))
+}
+
+// Strings repeated string flag
+type Strings []string
+
+func (s *Strings) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (s *Strings) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Canonical url canonicalization rules (for deduplicate urls)
+type Canonical struct {
+	SortQuery    bool    `yaml:"sort_query"`
+	StripParams  Strings `yaml:"strip_params"` // query params names or glob patterns, like utm_*
+	IgnoreScheme bool    `yaml:"ignore_scheme"`
+}
+
+// Canonicalizer convert to url canonicalizer
+func (c *Canonical) Canonicalizer() urlutils.Canonicalizer {
+	return urlutils.Canonicalizer{SortQuery: c.SortQuery, StripParams: c.StripParams, IgnoreScheme: c.IgnoreScheme}
+}
+
+// Quotas download limits (0 or empty for unlimited)
+type Quotas struct {
+	MaxFileSize  int64   `yaml:"max_file_size"`         // max file size in bytes
+	AllowTypes   Strings `yaml:"allow_types,omitempty"` // allowed content types (glob patterns, like image/*)
+	DenyTypes    Strings `yaml:"deny_types,omitempty"`  // denied content types (glob patterns, like video/*)
+	MaxBytes     int64   `yaml:"max_bytes"`             // max total downloaded bytes per run
+	MaxHostBytes int64   `yaml:"max_host_bytes"`        // max downloaded bytes per host per run
+	MaxFiles     int64   `yaml:"max_files"`             // max downloaded files per run
+}
+
+// Quotas convert to downloader quotas
+func (q *Quotas) Quotas() downloader.Quotas {
+	return downloader.Quotas{
+		MaxFileSize:  q.MaxFileSize,
+		AllowTypes:   q.AllowTypes,
+		DenyTypes:    q.DenyTypes,
+		MaxBytes:     q.MaxBytes,
+		MaxHostBytes: q.MaxHostBytes,
+		MaxFiles:     q.MaxFiles,
+	}
+}
+
+// Auth host credentials (values from *_env environment variables take precedence)
+type Auth struct {
+	Host        string `yaml:"host"`
+	Type        string `yaml:"type"` // basic, digest or bearer
+	User        string `yaml:"user,omitempty"`
+	UserEnv     string `yaml:"user_env,omitempty"`
+	Password    string `yaml:"password,omitempty"`
+	PasswordEnv string `yaml:"password_env,omitempty"`
+	Token       string `yaml:"token,omitempty"`
+	TokenEnv    string `yaml:"token_env,omitempty"`
+}
+
+func envValue(value, env string) (string, error) {
+	if len(env) == 0 {
+		return value, nil
+	}
+	v, ok := os.LookupEnv(env)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s not set", env)
+	}
+	return v, nil
+}
+
+// Auth convert to downloader credentials
+func (a *Auth) Auth() (auth downloader.Auth, err error) {
+	auth.Host = a.Host
+	if len(a.Type) > 0 {
+		if err = auth.Type.Set(a.Type); err != nil {
+			return
+		}
+	}
+	if auth.User, err = envValue(a.User, a.UserEnv); err != nil {
+		return
+	}
+	if auth.Password, err = envValue(a.Password, a.PasswordEnv); err != nil {
+		return
+	}
+	auth.Token, err = envValue(a.Token, a.TokenEnv)
+	return
+}
+
+type AuthSlice []Auth
+
+// Set parse auth flag 'HOST basic|digest USER_ENV PASSWORD_ENV' or 'HOST bearer TOKEN_ENV'
+func (a *AuthSlice) Set(value string) error {
+	s := strings.Split(value, " ")
+	if len(s) < 3 {
+		return fmt.Errorf("auth must have format 'HOST basic|digest USER_ENV PASSWORD_ENV' or 'HOST bearer TOKEN_ENV': '%s'", value)
+	}
+	var authType downloader.AuthType
+	if err := authType.Set(s[1]); err != nil {
+		return err
+	}
+	auth := Auth{Host: s[0], Type: s[1]}
+	if authType == downloader.BearerAuth {
+		if len(s) != 3 {
+			return fmt.Errorf("auth must have format 'HOST bearer TOKEN_ENV': '%s'", value)
+		}
+		auth.TokenEnv = s[2]
+	} else {
+		if len(s) != 4 {
+			return fmt.Errorf("auth must have format 'HOST basic|digest USER_ENV PASSWORD_ENV': '%s'", value)
+		}
+		auth.UserEnv = s[2]
+		auth.PasswordEnv = s[3]
+	}
+	*a = append(*a, auth)
+	return nil
+}
+
+func (a *AuthSlice) String() string {
+	return fmt.Sprintf("%+v", *a)
+}
+
+// LoginForm login form, posted before crawl start
+type LoginForm struct {
+	URL       string            `yaml:"url"`
+	Fields    map[string]string `yaml:"-"`                    // not saved (may contain credentials)
+	FieldsEnv map[string]string `yaml:"fields_env,omitempty"` // field name -> environment variable
+}
+
+// LoginForm convert to downloader login form
+func (l *LoginForm) LoginForm() (*downloader.LoginForm, error) {
+	form := &downloader.LoginForm{URL: l.URL, Fields: make(url.Values)}
+	for k, v := range l.Fields {
+		form.Fields.Set(k, v)
+	}
+	for k, env := range l.FieldsEnv {
+		v, err := envValue("", env)
+		if err != nil {
+			return nil, err
+		}
+		form.Fields.Set(k, v)
+	}
+	return form, nil
+}
+
+// Filter url filter rule (glob or regex over url, path or host)
+type Filter struct {
+	Target string `yaml:"target,omitempty"` // url (default), path or host
+	Glob   string `yaml:"glob,omitempty"`   // glob pattern (* match any chars, including /)
+	Regex  string `yaml:"regex,omitempty"`
+}
+
+// Filter convert to downloader filter
+func (f *Filter) Filter() (filter downloader.Filter, err error) {
+	if len(f.Target) > 0 {
+		if err = filter.Target.Set(f.Target); err != nil {
+			return
+		}
+	}
+	filter.Glob = f.Glob
+	filter.Regex = f.Regex
+	return
+}
+
+type Filters []Filter
+
+// Set parse filter flag '[url|path|host] glob|regex PATTERN'
+func (f *Filters) Set(value string) error {
+	s := strings.SplitN(value, " ", 3)
+	if len(s) != 3 {
+		return fmt.Errorf("filter must have format 'url|path|host glob|regex PATTERN': '%s'", value)
+	}
+	var target downloader.FilterTarget
+	if err := target.Set(s[0]); err != nil {
+		return err
+	}
+	filter := Filter{Target: s[0]}
+	switch s[1] {
+	case "glob":
+		filter.Glob = s[2]
+	case "regex":
+		filter.Regex = s[2]
+	default:
+		return fmt.Errorf("filter must have format 'url|path|host glob|regex PATTERN': '%s'", value)
+	}
+	*f = append(*f, filter)
+	return nil
+}
+
+func (f *Filters) String() string {
+	return fmt.Sprintf("%+v", *f)
+}
+
+// Filters convert to downloader filters
+func (f Filters) Filters() ([]downloader.Filter, error) {
+	filters := make([]downloader.Filter, len(f))
+	for i := range f {
+		var err error
+		if filters[i], err = f[i].Filter(); err != nil {
+			return nil, err
+		}
+	}
+	return filters, nil
+}
+
 type URL struct {
-	URL       string `yaml:"url"`
-	Level     int32  `yaml:"level"`
-	DownLevel int32  `yaml:"down_level"`
-	ExtLevel  int32  `yaml:"ext_level"`
+	URL        string      `yaml:"url"`
+	Level      int32       `yaml:"level"`
+	DownLevel  int32       `yaml:"down_level"`
+	ExtLevel   int32       `yaml:"ext_level"`
+	HostLimits *HostLimits `yaml:"host_limits,omitempty"` // override default host limits
+	Accept     Filters     `yaml:"accept,omitempty"`      // follow only links, matched any accept filter
+	Reject     Filters     `yaml:"reject,omitempty"`      // skip links, matched any reject filter
 }
 
 type URLslice []URL
@@ -111,7 +415,32 @@ type Config struct {
 	MaxRedirects int           `yaml:"max_redirects"`
 	Timeout      time.Duration `yaml:"timeout"`
 	SaveMode     SaveModeStr   `yaml:"save_mode"`
+	UserAgent    string        `yaml:"user_agent"`
+	IgnoreRobots bool          `yaml:"ignore_robots"`
+	ConvertLinks bool          `yaml:"convert_links"` // rewrite links to relative local paths after download
+	Canonical    Canonical     `yaml:"canonical"`
+	HostLimits   HostLimits    `yaml:"host_limits"`
+	RoundRobin   bool          `yaml:"round_robin"` // per host round-robin scheduling
+	Quotas       Quotas        `yaml:"quotas"`
+	HTTP         HTTP          `yaml:"http"`
+	Cookies      string        `yaml:"-"` // import cookies from Netscape cookies.txt file (session resumed from output dir)
+	Auth         AuthSlice     `yaml:"auth,omitempty"`
+	LoginForm    *LoginForm    `yaml:"login_form,omitempty"`
 	Parallel     int
+	NoProgress   bool   `yaml:"-"` // disable progress display
+	Graph        string `yaml:"-"` // link graph export file
+}
+
+func httpDefault() HTTP {
+	h := downloader.DefaultHTTPConfig()
+	return HTTP{
+		MaxIdleConns:        h.MaxIdleConns,
+		MaxIdleConnsPerHost: h.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     h.MaxConnsPerHost,
+		IdleConnTimeout:     h.IdleConnTimeout,
+		HTTP2:               h.HTTP2,
+		Proxy:               h.Proxy,
+	}
 }
 
 func defaultConfig() *Config {
@@ -121,6 +450,8 @@ func defaultConfig() *Config {
 		MaxRedirects: 0,
 		Timeout:      1 * time.Second,
 		SaveMode:     "flat",
+		UserAgent:    downloader.DefaultUserAgent,
+		HTTP:         httpDefault(),
 		Parallel:     1,
 	}
 
@@ -147,23 +478,63 @@ func SaveConfig(dir string, cfg *Config) error {
 	return ioutil.WriteFile(dir+"/"+CONFIG_FILE, yml, 0o644)
 }
 
+// crawlFlags register crawl flags (shared by new and check commands)
+func crawlFlags(f *flag.FlagSet, cfg *Config, accept, reject *Filters, login *LoginForm, logLevel *LogLevel, showHelp *bool) {
+	f.IntVar(&cfg.Parallel, "parallel", 1, "parallel")
+	f.IntVar(&cfg.Retry, "retry", 1, "retry")
+	f.IntVar(&cfg.MaxRedirects, "redirects", 0, "max redirects")
+	f.DurationVar(&cfg.Timeout, "timeout", 0, "timeout")
+	f.StringVar(&cfg.UserAgent, "useragent", downloader.DefaultUserAgent, "User-Agent header")
+	f.BoolVar(&cfg.IgnoreRobots, "ignore-robots", false, "ignore robots.txt")
+	f.BoolVar(&cfg.Canonical.SortQuery, "sort-query", false, "sort query params for deduplicate urls")
+	f.Var(&cfg.Canonical.StripParams, "strip-param", "strip query param (name or glob pattern, like utm_*) for deduplicate urls (can be repeated)")
+	f.BoolVar(&cfg.Canonical.IgnoreScheme, "ignore-scheme", false, "treat http and https urls as same")
+	f.Var(accept, "accept", "follow only links, matched accept filter 'url|path|host glob|regex PATTERN' (can be repeated)")
+	f.Var(reject, "reject", "skip links, matched reject filter 'url|path|host glob|regex PATTERN' (can be repeated)")
+	f.Float64Var(&cfg.HostLimits.Rate, "rate", 0, "max requests per second per host (0 for unlimited)")
+	f.IntVar(&cfg.HostLimits.Burst, "burst", 1, "max burst requests per host")
+	f.IntVar(&cfg.HostLimits.MaxConns, "max-conns", 0, "max concurrent requests per host (0 for unlimited)")
+	f.BoolVar(&cfg.RoundRobin, "round-robin", false, "schedule hosts in turn (else page requisites first, then pages by level for all hosts)")
+	f.StringVar(&cfg.HTTP.Proxy, "proxy", downloader.ProxyFromEnv, "proxy url (http://, https:// or socks5://), env or blank for direct connections")
+	f.BoolVar(&cfg.HTTP.HTTP2, "http2", true, "try HTTP/2")
+	f.StringVar(&cfg.HTTP.CACert, "cacert", "", "CA bundle file (PEM)")
+	f.BoolVar(&cfg.HTTP.InsecureSkipVerify, "insecure", false, "skip TLS certificate verify")
+	f.StringVar(&cfg.HTTP.ClientCert, "cert", "", "client certificate file (PEM)")
+	f.StringVar(&cfg.HTTP.ClientKey, "key", "", "client certificate key file (PEM)")
+	f.Var((*Headers)(&cfg.HTTP.Headers), "header", "request header 'Name: value' (can be repeated, not saved for continue)")
+	f.Var((*Fields)(&cfg.HTTP.HeadersEnv), "header-env", "request header from environment 'Name=ENV' (can be repeated)")
+	f.StringVar(&cfg.Cookies, "cookies", "", "import cookies from Netscape cookies.txt file")
+	f.Var(&cfg.Auth, "auth", "host credentials from environment 'HOST basic|digest USER_ENV PASSWORD_ENV' or 'HOST bearer TOKEN_ENV' (can be repeated)")
+	f.StringVar(&login.URL, "login-url", "", "login form url, posted before crawl start")
+	f.Var((*Fields)(&login.Fields), "login-field", "login form field 'name=value' (can be repeated, not saved for continue)")
+	f.Var((*Fields)(&login.FieldsEnv), "login-field-env", "login form field from environment 'name=ENV' (can be repeated)")
+	f.Var(logLevel, "loglevel", "loglevel [debug | info | warn]")
+	f.BoolVar(&cfg.NoProgress, "no-progress", false, "disable progress display (disabled if stderr is not a terminal)")
+	f.StringVar(&cfg.Graph, "graph", "", "write link graph to file (DOT for .dot or .gv extension, JSON else)")
+	f.BoolVar(showHelp, "help", false, "help")
+}
+
 // LoadConfig load config file/parse cmd args
 func Configuration(args []string) (string, zerolog.Level, *Config, error) {
 	cfg := defaultConfig()
 
 	showHelp := false
 	var dir string
+	var accept, reject Filters
+	var login LoginForm
 	logLevel := LogLevel("warn")
 
 	flagNew := flag.NewFlagSet("new", flag.ContinueOnError)
 	flagNew.StringVar(&dir, "dir", "", "out dir")
-	flagNew.IntVar(&cfg.Parallel, "parallel", 1, "parallel")
-	flagNew.IntVar(&cfg.Retry, "retry", 1, "retry")
-	flagNew.IntVar(&cfg.MaxRedirects, "redirects", 0, "max redirects")
-	flagNew.DurationVar(&cfg.Timeout, "timeout", 0, "timeout")
 	flagNew.Var(&cfg.SaveMode, "save", "save mode [ flat | flat_dir | site_dir | dir ]")
-	flagNew.Var(&logLevel, "loglevel", "loglevel [debug | info | warn]")
-	flagNew.BoolVar(&showHelp, "help", false, "help")
+	flagNew.BoolVar(&cfg.ConvertLinks, "convert-links", false, "convert links in downloaded html and css files to relative local paths")
+	flagNew.Int64Var(&cfg.Quotas.MaxFileSize, "max-file-size", 0, "max file size in bytes (0 for unlimited)")
+	flagNew.Var(&cfg.Quotas.AllowTypes, "allow-type", "allowed content type (or glob pattern, like image/*), html pages must be allowed for follow links (can be repeated)")
+	flagNew.Var(&cfg.Quotas.DenyTypes, "deny-type", "denied content type (or glob pattern, like video/*) (can be repeated)")
+	flagNew.Int64Var(&cfg.Quotas.MaxBytes, "max-bytes", 0, "max total downloaded bytes per run (0 for unlimited)")
+	flagNew.Int64Var(&cfg.Quotas.MaxHostBytes, "max-host-bytes", 0, "max downloaded bytes per host per run (0 for unlimited)")
+	flagNew.Int64Var(&cfg.Quotas.MaxFiles, "max-files", 0, "max downloaded files per run (0 for unlimited)")
+	crawlFlags(flagNew, cfg, &accept, &reject, &login, &logLevel, &showHelp)
 	helpNew := func() {
 		fmt.Fprintf(os.Stderr, "\n%s new OPTIONS 'url1 LEVEL DOWN_LEVEL EXT_LEVEL' ..\n", args[0])
 		flagNew.Usage()
@@ -173,52 +544,108 @@ func Configuration(args []string) (string, zerolog.Level, *Config, error) {
 	flagCont.StringVar(&dir, "dir", "", "out dir")
 	flagCont.IntVar(&cfg.Parallel, "parallel", 1, "parallel")
 	flagCont.Var(&logLevel, "loglevel", "loglevel [debug | info | warn]")
+	flagCont.BoolVar(&cfg.NoProgress, "no-progress", false, "disable progress display (disabled if stderr is not a terminal)")
+	flagCont.StringVar(&cfg.Graph, "graph", "", "write link graph to file (DOT for .dot or .gv extension, JSON else)")
+	flagCont.StringVar(&cfg.Cookies, "cookies", "", "import cookies from Netscape cookies.txt file")
 	flagCont.BoolVar(&showHelp, "help", false, "help")
 	helpCont := func() {
 		fmt.Fprintf(os.Stderr, "\n%s continue OPTIONS\n", args[0])
 		flagCont.Usage()
 	}
 
+	flagUpdate := flag.NewFlagSet("update", flag.ContinueOnError)
+	flagUpdate.StringVar(&dir, "dir", "", "out dir")
+	flagUpdate.IntVar(&cfg.Parallel, "parallel", 1, "parallel")
+	flagUpdate.Var(&logLevel, "loglevel", "loglevel [debug | info | warn]")
+	flagUpdate.BoolVar(&cfg.NoProgress, "no-progress", false, "disable progress display (disabled if stderr is not a terminal)")
+	flagUpdate.StringVar(&cfg.Graph, "graph", "", "write link graph to file (DOT for .dot or .gv extension, JSON else)")
+	flagUpdate.StringVar(&cfg.Cookies, "cookies", "", "import cookies from Netscape cookies.txt file")
+	flagUpdate.BoolVar(&showHelp, "help", false, "help")
+	helpUpdate := func() {
+		fmt.Fprintf(os.Stderr, "\n%s update OPTIONS\n", args[0])
+		flagUpdate.Usage()
+	}
+
+	flagCheck := flag.NewFlagSet("check", flag.ContinueOnError)
+	crawlFlags(flagCheck, cfg, &accept, &reject, &login, &logLevel, &showHelp)
+	helpCheck := func() {
+		fmt.Fprintf(os.Stderr, "\n%s check OPTIONS 'url1 LEVEL DOWN_LEVEL EXT_LEVEL' .. (check for broken links, files not saved)\n", args[0])
+		flagCheck.Usage()
+	}
+
+	flagReport := flag.NewFlagSet("report", flag.ContinueOnError)
+	flagReport.StringVar(&dir, "dir", "", "out dir")
+	flagReport.StringVar(&cfg.Graph, "graph", "", "write link graph to file (DOT for .dot or .gv extension, JSON else)")
+	flagReport.Var(&logLevel, "loglevel", "loglevel [debug | info | warn]")
+	flagReport.BoolVar(&showHelp, "help", false, "help")
+	helpReport := func() {
+		fmt.Fprintf(os.Stderr, "\n%s report OPTIONS (regenerate report from map)\n", args[0])
+		flagReport.Usage()
+	}
+
 	helpAll := func() {
 		fmt.Fprintf(os.Stderr, "%s: mirror of http sites\n", args[0])
 		helpNew()
 		helpCont()
+		helpUpdate()
+		helpReport()
+		helpCheck()
 	}
 
 	if len(args) > 1 {
 		switch os.Args[1] {
-		case "new":
-			err := flagNew.Parse(args[2:])
+		case "new", "check":
+			flagSet, help := flagNew, helpNew
+			if args[1] == "check" {
+				flagSet, help = flagCheck, helpCheck
+			}
+			err := flagSet.Parse(args[2:])
 			if err == nil && showHelp {
-				helpNew()
+				help()
 			}
 			if err != nil || showHelp {
 				os.Exit(1)
 			}
-			for _, value := range flagNew.Args() {
+			for _, value := range flagSet.Args() {
 				if err = cfg.Urls.Set(value); err != nil {
 					fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 					os.Exit(1)
 				}
 			}
-			if len(dir) == 0 {
+			for i := range cfg.Urls {
+				cfg.Urls[i].Accept = accept
+				cfg.Urls[i].Reject = reject
+			}
+			if len(login.URL) > 0 {
+				cfg.LoginForm = &login
+			} else if len(login.Fields) > 0 || len(login.FieldsEnv) > 0 {
+				return dir, logLevel.Level(), nil, fmt.Errorf("configuration: login fields set without login url")
+			}
+			if len(dir) == 0 && args[1] == "new" {
 				return dir, logLevel.Level(), nil, fmt.Errorf("configuration: dir not set")
 			}
-		case "continue":
-			err := flagCont.Parse(args[2:])
+		case "continue", "update", "report":
+			flagSet, help := flagCont, helpCont
+			switch args[1] {
+			case "update":
+				flagSet, help = flagUpdate, helpUpdate
+			case "report":
+				flagSet, help = flagReport, helpReport
+			}
+			err := flagSet.Parse(args[2:])
 			if err == nil && showHelp {
-				helpCont()
+				help()
 			}
 			if err != nil || showHelp {
 				os.Exit(1)
 			}
-			f := flagCont.Args()
+			f := flagSet.Args()
 			if len(f) > 0 {
 				fmt.Fprintf(os.Stderr, "non-flag arguments:\n")
 				for _, value := range f {
 					fmt.Fprintf(os.Stderr, "  '%s'\n", value)
 				}
-				helpCont()
+				help()
 				os.Exit(1)
 			}
 			if len(dir) == 0 {
@@ -255,6 +682,12 @@ func Configuration(args []string) (string, zerolog.Level, *Config, error) {
 	if cfg.Timeout < 0 {
 		cfg.Timeout = 0
 	}
+	if cfg.HostLimits.Rate < 0 || cfg.HostLimits.MaxConns < 0 {
+		return dir, logLevel.Level(), cfg, fmt.Errorf("configuration: host limits < 0")
+	}
+	if cfg.Quotas.MaxFileSize < 0 || cfg.Quotas.MaxBytes < 0 || cfg.Quotas.MaxHostBytes < 0 || cfg.Quotas.MaxFiles < 0 {
+		return dir, logLevel.Level(), cfg, fmt.Errorf("configuration: quotas < 0")
+	}
 
 	return dir, logLevel.Level(), cfg, nil
 }
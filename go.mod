@@ -5,9 +5,7 @@ go 1.14
 require (
 	github.com/calbucci/go-htmlparser v0.0.0-20150912033436-b0723c976eb4
 	github.com/cornelk/hashmap v1.0.1
-	github.com/franela/goreq v0.0.0-20171204163338-bcd34c9993f8
 	github.com/goware/urlx v0.3.1
-	github.com/msaf1980/go-lockfree-queue v0.0.0-20200822061714-35c92fde4d45
 	github.com/mxmCherry/translit v1.0.0
 	github.com/rs/zerolog v1.19.0
 	github.com/sergi/go-diff v1.1.0
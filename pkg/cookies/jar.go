@@ -0,0 +1,281 @@
+package cookies
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const httpOnlyPrefix = "#HttpOnly_"
+
+// Entry cookie entry (in Netscape cookies.txt notation)
+type Entry struct {
+	Domain   string // domain (without leading dot)
+	HostOnly bool   // not sent to subdomains
+	Path     string
+	Secure   bool
+	HTTPOnly bool
+	Expires  time.Time // zero for session cookie
+	Name     string
+	Value    string
+}
+
+func (e *Entry) key() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+// Jar http.CookieJar with cookies tracking (for save to Netscape cookies.txt)
+type Jar struct {
+	jar *cookiejar.Jar
+
+	lock    sync.Mutex
+	entries map[string]*Entry
+}
+
+// New return new cookie jar
+func New() *Jar {
+	jar, _ := cookiejar.New(nil)
+	return &Jar{jar: jar, entries: make(map[string]*Entry)}
+}
+
+// defaultPath return cookie default path (RFC 6265 5.1.4)
+func defaultPath(urlPath string) string {
+	if len(urlPath) == 0 || urlPath[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(urlPath, "/")
+	if i == 0 {
+		return "/"
+	}
+	return urlPath[0:i]
+}
+
+// SetCookies implements the SetCookies method of the http.CookieJar interface
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, c := range cookies {
+		e := &Entry{
+			Domain: strings.TrimPrefix(strings.ToLower(c.Domain), "."),
+			Path:   c.Path, Secure: c.Secure, HTTPOnly: c.HttpOnly,
+			Name: c.Name, Value: c.Value,
+		}
+		if len(e.Domain) == 0 {
+			e.Domain = strings.ToLower(u.Hostname())
+			e.HostOnly = true
+		}
+		if len(e.Path) == 0 || e.Path[0] != '/' {
+			e.Path = defaultPath(u.Path)
+		}
+		if c.MaxAge > 0 {
+			e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		} else if !c.Expires.IsZero() {
+			e.Expires = c.Expires
+		}
+		if c.MaxAge < 0 || (!e.Expires.IsZero() && e.Expires.Before(now)) {
+			delete(j.entries, e.key())
+		} else if j.accepted(e) {
+			j.entries[e.key()] = e
+		}
+	}
+}
+
+// accepted check for cookie entry stored by cookiejar (cookies for foreign domains are rejected)
+func (j *Jar) accepted(e *Entry) bool {
+	scheme := "http"
+	if e.Secure {
+		scheme = "https"
+	}
+	u := &url.URL{Scheme: scheme, Host: e.Domain, Path: e.Path}
+	for _, c := range j.jar.Cookies(u) {
+		if c.Name == e.Name && c.Value == e.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// Cookies implements the Cookies method of the http.CookieJar interface
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// Entries return stored cookies (sorted by domain, path and name)
+func (j *Jar) Entries() []*Entry {
+	now := time.Now()
+	j.lock.Lock()
+	entries := make([]*Entry, 0, len(j.entries))
+	for _, e := range j.entries {
+		if e.Expires.IsZero() || e.Expires.After(now) {
+			entries = append(entries, e)
+		}
+	}
+	j.lock.Unlock()
+	sort.Slice(entries, func(i, k int) bool {
+		return entries[i].key() < entries[k].key()
+	})
+	return entries
+}
+
+// Add add cookie entry
+func (j *Jar) Add(e *Entry) {
+	scheme := "http"
+	if e.Secure {
+		scheme = "https"
+	}
+	u := &url.URL{Scheme: scheme, Host: e.Domain, Path: e.Path}
+	c := &http.Cookie{
+		Name: e.Name, Value: e.Value, Path: e.Path,
+		Secure: e.Secure, HttpOnly: e.HTTPOnly, Expires: e.Expires,
+	}
+	if !e.HostOnly {
+		c.Domain = e.Domain
+	}
+	j.SetCookies(u, []*http.Cookie{c})
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToUpper(s) {
+	case "TRUE":
+		return true, nil
+	case "FALSE":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean '%s'", s)
+	}
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// ParseEntry parse Netscape cookies.txt line (nil for comment or blank line)
+func ParseEntry(line string) (*Entry, error) {
+	line = strings.TrimRight(line, "\r\n")
+	e := &Entry{}
+	if strings.HasPrefix(line, httpOnlyPrefix) {
+		e.HTTPOnly = true
+		line = line[len(httpOnlyPrefix):]
+	} else if len(strings.TrimSpace(line)) == 0 || line[0] == '#' {
+		return nil, nil
+	}
+	s := strings.Split(line, "\t")
+	if len(s) != 7 {
+		return nil, fmt.Errorf("cookie line incomplete: %s", line)
+	}
+	includeSubdomains, err := parseBool(s[1])
+	if err != nil {
+		return nil, err
+	}
+	if e.Secure, err = parseBool(s[3]); err != nil {
+		return nil, err
+	}
+	expires, err := strconv.ParseInt(s[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cookie expires must be a number: %s", line)
+	}
+	if expires > 0 {
+		e.Expires = time.Unix(expires, 0)
+	}
+	e.Domain = strings.TrimPrefix(strings.ToLower(s[0]), ".")
+	e.HostOnly = !includeSubdomains
+	e.Path = s[2]
+	e.Name = s[5]
+	e.Value = s[6]
+	return e, nil
+}
+
+// String return Netscape cookies.txt line
+func (e *Entry) String() string {
+	var sb strings.Builder
+	if e.HTTPOnly {
+		sb.WriteString(httpOnlyPrefix)
+	}
+	if !e.HostOnly {
+		sb.WriteRune('.')
+	}
+	var expires int64
+	if !e.Expires.IsZero() {
+		expires = e.Expires.Unix()
+	}
+	sb.WriteString(strings.Join([]string{
+		e.Domain, formatBool(!e.HostOnly), e.Path, formatBool(e.Secure),
+		strconv.FormatInt(expires, 10), e.Name, e.Value,
+	}, "\t"))
+	return sb.String()
+}
+
+// Load import cookies from Netscape cookies.txt
+func (j *Jar) Load(r io.Reader) error {
+	now := time.Now()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		e, err := ParseEntry(scanner.Text())
+		if err != nil {
+			return err
+		}
+		if e == nil || (!e.Expires.IsZero() && e.Expires.Before(now)) {
+			continue
+		}
+		j.Add(e)
+	}
+	return scanner.Err()
+}
+
+// LoadFile import cookies from Netscape cookies.txt file
+func (j *Jar) LoadFile(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return j.Load(f)
+}
+
+// Save export cookies to Netscape cookies.txt
+func (j *Jar) Save(w io.Writer) error {
+	if _, err := io.WriteString(w, "# Netscape HTTP Cookie File\n"); err != nil {
+		return err
+	}
+	for _, e := range j.Entries() {
+		if _, err := io.WriteString(w, e.String()+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveFile export cookies to Netscape cookies.txt file (atomic replace)
+func (j *Jar) SaveFile(fileName string) error {
+	tmpfile := path.Join(path.Dir(fileName), "."+path.Base(fileName)+".part")
+	f, err := os.OpenFile(tmpfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = j.Save(f)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpfile, fileName)
+	}
+	return err
+}
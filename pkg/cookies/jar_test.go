@@ -0,0 +1,157 @@
+package cookies
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cookiesTxt = `# Netscape HTTP Cookie File
+# comment
+
+.test.int	TRUE	/	FALSE	0	session	s1
+www.test.int	FALSE	/docs	TRUE	4102444800	secure	s2
+#HttpOnly_.test.int	TRUE	/	FALSE	4102444800	http_only	s3
+.test.int	TRUE	/	FALSE	946684800	expired	s4
+`
+
+func cookieNames(cookies []*http.Cookie) string {
+	names := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestJar_Load(t *testing.T) {
+	j := New()
+	if err := j.Load(strings.NewReader(cookiesTxt)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://test.int/", "session=s1 http_only=s3"},
+		{"http://sub.test.int/index.html", "session=s1 http_only=s3"},
+		{"http://www.test.int/docs/index.html", "session=s1 http_only=s3"},
+		{"https://www.test.int/docs/index.html", "secure=s2 session=s1 http_only=s3"},
+		{"https://sub.www.test.int/docs/index.html", "session=s1 http_only=s3"},
+		{"http://other.int/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := cookieNames(j.Cookies(u)); got != tt.want {
+				t.Errorf("Jar.Cookies() = '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJar_Save(t *testing.T) {
+	j := New()
+	if err := j.Load(strings.NewReader(cookiesTxt)); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://www.test.int/login/form.html")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "login", Value: "user", MaxAge: 3600},
+		{Name: "session", Value: "s1", Domain: "test.int", Path: "/", MaxAge: -1},
+	})
+
+	var buf bytes.Buffer
+	if err := j.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// reload
+	jv := New()
+	if err := jv.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	entries := jv.Entries()
+	want := []string{"http_only", "secure", "login"}
+	if len(entries) != len(want) {
+		t.Fatalf("Jar.Entries() len = %d, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Name != want[i] {
+			t.Errorf("Jar.Entries()[%d] = '%s', want '%s'", i, e.Name, want[i])
+		}
+	}
+	login := entries[2]
+	if !login.HostOnly || login.Domain != "www.test.int" || login.Path != "/login" {
+		t.Errorf("Jar.Entries() login = %+v", login)
+	}
+	if login.Expires.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("Jar.Entries() login expires = %v", login.Expires)
+	}
+	if !entries[0].HTTPOnly {
+		t.Errorf("Jar.Entries() http_only not HttpOnly")
+	}
+
+	u, _ = url.Parse("http://www.test.int/login/")
+	if got := cookieNames(jv.Cookies(u)); got != "login=user http_only=s3" {
+		t.Errorf("Jar.Cookies() = '%s', want '%s'", got, "login=user http_only=s3")
+	}
+}
+
+func TestJar_SetCookies_foreignDomain(t *testing.T) {
+	j := New()
+	u, _ := url.Parse("http://www.test.int/index.html")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "local", Value: "l1", Domain: "test.int", Path: "/"},
+		{Name: "foreign", Value: "f1", Domain: "other.example", Path: "/"},
+	})
+
+	entries := j.Entries()
+	if len(entries) != 1 || entries[0].Name != "local" {
+		t.Fatalf("Jar.Entries() = %v, want only local", entries)
+	}
+
+	// rejected cookie not restored from saved session
+	var buf bytes.Buffer
+	if err := j.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	jv := New()
+	if err := jv.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse("http://other.example/")
+	if got := cookieNames(jv.Cookies(u)); got != "" {
+		t.Errorf("Jar.Cookies() = '%s' for foreign domain, want ''", got)
+	}
+	u, _ = url.Parse("http://test.int/")
+	if got := cookieNames(jv.Cookies(u)); got != "local=l1" {
+		t.Errorf("Jar.Cookies() = '%s', want 'local=l1'", got)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		line    string
+		wantErr bool
+	}{
+		{"test.int\tFALSE\t/\tFALSE\t0\tname\tvalue", false},
+		{"test.int\tFALSE\t/\tFALSE\t0\tname", true},
+		{"test.int\tNO\t/\tFALSE\t0\tname\tvalue", true},
+		{"test.int\tFALSE\t/\tFALSE\tnever\tname\tvalue", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			e, err := ParseEntry(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && e.String() != tt.line {
+				t.Errorf("Entry.String() = '%s', want '%s'", e.String(), tt.line)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package downloader
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type AuthType int8
+
+const (
+	// BasicAuth HTTP Basic authentication
+	BasicAuth AuthType = iota
+	// DigestAuth HTTP Digest authentication
+	DigestAuth
+	// BearerAuth Authorization: Bearer token
+	BearerAuth
+)
+
+var (
+	authTypeMap = map[string]AuthType{"basic": BasicAuth, "digest": DigestAuth, "bearer": BearerAuth}
+	authTypeStr = []string{"basic", "digest", "bearer"}
+)
+
+func (a *AuthType) Set(value string) error {
+	authType, ok := authTypeMap[strings.ToLower(value)]
+	if ok {
+		*a = authType
+		return nil
+	}
+	return fmt.Errorf("unknown auth type: '%s'", value)
+}
+
+func (a *AuthType) String() string {
+	return authTypeStr[*a]
+}
+
+// Auth host credentials (sent only to matching host)
+type Auth struct {
+	Host     string // host (with port for non-default ports)
+	Type     AuthType
+	User     string
+	Password string
+	Token    string // bearer token
+}
+
+// LoginForm login form, posted before crawl start (session cookies stored in cookie jar)
+type LoginForm struct {
+	URL    string
+	Fields url.Values
+}
+
+// hostAuth host credentials with digest challenge state
+type hostAuth struct {
+	Auth
+
+	lock      sync.Mutex
+	challenge map[string]string // last digest challenge
+	nc        int
+}
+
+// SetAuth set per host credentials
+func (d *Downloader) SetAuth(auth []Auth) error {
+	hosts := make(map[string]*hostAuth)
+	for i := range auth {
+		host := strings.ToLower(auth[i].Host)
+		if len(host) == 0 {
+			return fmt.Errorf("auth host not set")
+		}
+		if _, exist := hosts[host]; exist {
+			return fmt.Errorf("auth for host %s already set", host)
+		}
+		if auth[i].Type == BearerAuth {
+			if len(auth[i].Token) == 0 {
+				return fmt.Errorf("auth token for host %s not set", host)
+			}
+		} else if len(auth[i].User) == 0 {
+			return fmt.Errorf("auth user for host %s not set", host)
+		}
+		hosts[host] = &hostAuth{Auth: auth[i]}
+	}
+	d.auth = hosts
+	return nil
+}
+
+// SetLoginForm set login form, posted before crawl start
+func (d *Downloader) SetLoginForm(form *LoginForm) {
+	d.loginForm = form
+}
+
+// hostAuth return credentials for request host
+func (d *Downloader) hostAuth(u *url.URL) *hostAuth {
+	if len(d.auth) == 0 {
+		return nil
+	}
+	if a, ok := d.auth[strings.ToLower(u.Host)]; ok {
+		return a
+	}
+	return d.auth[strings.ToLower(u.Hostname())]
+}
+
+// login post login form
+func (d *Downloader) login() error {
+	form := d.loginForm
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, form.URL, strings.NewReader(form.Fields.Encode()))
+	if err != nil {
+		return err
+	}
+	for k, v := range d.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("login failed with http status %d", resp.StatusCode)
+	}
+	d.logger.Info().Str("url", form.URL).Int("status", resp.StatusCode).Msg("login")
+	return nil
+}
+
+// authTransport add credentials to requests for matching hosts
+type authTransport struct {
+	d    *Downloader
+	next http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	a := t.d.hostAuth(req.URL)
+	if a == nil || len(req.Header.Get("Authorization")) > 0 {
+		return t.next.RoundTrip(req)
+	}
+	switch a.Type {
+	case BasicAuth:
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(a.User, a.Password)
+		return t.next.RoundTrip(req)
+	case BearerAuth:
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+		return t.next.RoundTrip(req)
+	case DigestAuth:
+		return t.digestRoundTrip(a, req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+func (t *authTransport) digestRoundTrip(a *hostAuth, req *http.Request) (*http.Response, error) {
+	origReq := req
+	if authorization, ok := a.digestAuthorization(req); ok {
+		req = origReq.Clone(origReq.Context())
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if challenge == nil {
+		return resp, nil
+	}
+	if req != origReq && challenge["stale"] != "true" {
+		// credentials rejected
+		return resp, nil
+	}
+	if origReq.Body != nil {
+		if origReq.GetBody == nil {
+			return resp, nil
+		}
+		body, err := origReq.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		req = origReq.Clone(origReq.Context())
+		req.Body = body
+	} else {
+		req = origReq.Clone(origReq.Context())
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	a.lock.Lock()
+	a.challenge = challenge
+	a.nc = 0
+	a.lock.Unlock()
+	authorization, _ := a.digestAuthorization(req)
+	req.Header.Set("Authorization", authorization)
+	return t.next.RoundTrip(req)
+}
+
+// parseDigestChallenge parse WWW-Authenticate: Digest challenge params
+func parseDigestChallenge(header string) map[string]string {
+	if len(header) < 7 || !strings.EqualFold(header[0:7], "Digest ") {
+		return nil
+	}
+	params := make(map[string]string)
+	s := header[7:]
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		i := strings.Index(s, "=")
+		if i == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[0:i]))
+		s = s[i+1:]
+		var value string
+		if len(s) > 0 && s[0] == '"' {
+			end := strings.Index(s[1:], "\"")
+			if end == -1 {
+				value = s[1:]
+				s = ""
+			} else {
+				value = s[1 : end+1]
+				s = s[end+2:]
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end == -1 {
+				value = s
+				s = ""
+			} else {
+				value = s[0:end]
+				s = s[end:]
+			}
+		}
+		params[key] = strings.TrimSpace(value)
+	}
+	if len(params["nonce"]) == 0 {
+		return nil
+	}
+	return params
+}
+
+func digestHash(algorithm string) hash.Hash {
+	if strings.HasPrefix(strings.ToUpper(algorithm), "SHA-256") {
+		return sha256.New()
+	}
+	return md5.New()
+}
+
+func hashHex(h hash.Hash, s string) string {
+	h.Reset()
+	_, _ = io.WriteString(h, s)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// digestAuthorization build Authorization header from last challenge
+func (a *hostAuth) digestAuthorization(req *http.Request) (string, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.challenge == nil {
+		return "", false
+	}
+	c := a.challenge
+	a.nc++
+	nc := fmt.Sprintf("%08x", a.nc)
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	cnonce := hex.EncodeToString(b)
+	uri := req.URL.RequestURI()
+
+	h := digestHash(c["algorithm"])
+	ha1 := hashHex(h, a.User+":"+c["realm"]+":"+a.Password)
+	if strings.HasSuffix(strings.ToLower(c["algorithm"]), "-sess") {
+		ha1 = hashHex(h, ha1+":"+c["nonce"]+":"+cnonce)
+	}
+	ha2 := hashHex(h, req.Method+":"+uri)
+
+	var qop string
+	for _, q := range strings.Split(c["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	var response string
+	if qop == "" {
+		response = hashHex(h, ha1+":"+c["nonce"]+":"+ha2)
+	} else {
+		response = hashHex(h, ha1+":"+c["nonce"]+":"+nc+":"+cnonce+":"+qop+":"+ha2)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Digest username=" + strconv.Quote(a.User))
+	sb.WriteString(", realm=" + strconv.Quote(c["realm"]))
+	sb.WriteString(", nonce=" + strconv.Quote(c["nonce"]))
+	sb.WriteString(", uri=" + strconv.Quote(uri))
+	if len(c["algorithm"]) > 0 {
+		sb.WriteString(", algorithm=" + c["algorithm"])
+	}
+	if qop != "" {
+		sb.WriteString(", qop=" + qop + ", nc=" + nc + ", cnonce=" + strconv.Quote(cnonce))
+	}
+	sb.WriteString(", response=" + strconv.Quote(response))
+	if len(c["opaque"]) > 0 {
+		sb.WriteString(", opaque=" + strconv.Quote(c["opaque"]))
+	}
+	return sb.String(), true
+}
@@ -0,0 +1,253 @@
+package downloader
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func md5Hex(s string) string {
+	h := md5.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// digestHandler verify digest auth (qop=auth, MD5)
+func digestHandler(user, password string) http.HandlerFunc {
+	const (
+		realm = "test"
+		nonce = "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+	)
+	return func(w http.ResponseWriter, req *http.Request) {
+		params := parseDigestChallenge(req.Header.Get("Authorization"))
+		if params != nil && params["username"] == user && params["nonce"] == nonce {
+			ha1 := md5Hex(user + ":" + realm + ":" + password)
+			ha2 := md5Hex(req.Method + ":" + params["uri"])
+			want := md5Hex(ha1 + ":" + nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+			if params["response"] == want {
+				fmt.Fprint(w, "ok")
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Digest realm="`+realm+`", qop="auth,auth-int", nonce="`+nonce+`", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+}
+
+func TestDownloader_auth(t *testing.T) {
+	var otherAuth string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		otherAuth = req.Header.Get("Authorization")
+		fmt.Fprint(w, "ok")
+	}))
+	defer other.Close()
+
+	basic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, password, ok := req.BasicAuth(); ok && user == "user" && password == "secret" {
+			fmt.Fprint(w, "ok")
+			return
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}))
+	defer basic.Close()
+
+	bearer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") == "Bearer token" {
+			fmt.Fprint(w, "ok")
+			return
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}))
+	defer bearer.Close()
+
+	digest := httptest.NewServer(digestHandler("user", "secret"))
+	defer digest.Close()
+
+	hostOf := func(s string) string {
+		u, _ := url.Parse(s)
+		return u.Host
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		auth       Auth
+		wantStatus int
+	}{
+		{"basic", basic.URL, Auth{Host: hostOf(basic.URL), Type: BasicAuth, User: "user", Password: "secret"}, http.StatusOK},
+		{"basic invalid", basic.URL, Auth{Host: hostOf(basic.URL), Type: BasicAuth, User: "user", Password: "invalid"}, http.StatusUnauthorized},
+		{"basic other host", basic.URL, Auth{Host: hostOf(other.URL), Type: BasicAuth, User: "user", Password: "secret"}, http.StatusUnauthorized},
+		{"bearer", bearer.URL, Auth{Host: hostOf(bearer.URL), Type: BearerAuth, Token: "token"}, http.StatusOK},
+		{"digest", digest.URL + "/dir/index.html?q=1", Auth{Host: hostOf(digest.URL), Type: DigestAuth, User: "user", Password: "secret"}, http.StatusOK},
+		{"digest invalid", digest.URL, Auth{Host: hostOf(digest.URL), Type: DigestAuth, User: "user", Password: "invalid"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(FlatMode, 1, time.Second, 1)
+			if err := d.SetAuth([]Auth{tt.auth}); err != nil {
+				t.Fatal(err)
+			}
+			// twice, for check cached digest challenge
+			for i := 0; i < 2; i++ {
+				req, _ := d.newRequest(tt.url)
+				resp, err := d.client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Fatalf("http status = %d, want %d", resp.StatusCode, tt.wantStatus)
+				}
+			}
+
+			// credentials not sent to other hosts
+			otherAuth = ""
+			req, _ := d.newRequest(other.URL)
+			resp, err := d.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if tt.auth.Host != hostOf(other.URL) && otherAuth != "" {
+				t.Errorf("credentials sent to other host: '%s'", otherAuth)
+			}
+		})
+	}
+}
+
+func TestDownloader_SetAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    []Auth
+		wantErr bool
+	}{
+		{"valid", []Auth{{Host: "test.int", User: "user"}, {Host: "test2.int", Type: BearerAuth, Token: "token"}}, false},
+		{"no host", []Auth{{User: "user"}}, true},
+		{"duplicate host", []Auth{{Host: "test.int", User: "user"}, {Host: "Test.int", User: "user"}}, true},
+		{"no token", []Auth{{Host: "test.int", Type: BearerAuth}}, true},
+		{"no user", []Auth{{Host: "test.int", Type: DigestAuth}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(FlatMode, 1, time.Second, 1)
+			if err := d.SetAuth(tt.auth); (err != nil) != tt.wantErr {
+				t.Errorf("Downloader.SetAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloader_login(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/login":
+			if req.Method != http.MethodPost || req.PostFormValue("user") != "user" || req.PostFormValue("password") != "secret" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+			http.Redirect(w, req, "/", http.StatusFound)
+		case "/private.html":
+			if c, err := req.Cookie("session"); err != nil || c.Value != "s1" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, "private")
+		default:
+			fmt.Fprint(w, "index")
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		password   string
+		wantErr    bool
+		wantStatus int
+	}{
+		{"login", "secret", false, http.StatusOK},
+		{"login failed", "invalid", true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(FlatMode, 1, time.Second, 1)
+			d.SetLoginForm(&LoginForm{URL: ts.URL + "/login", Fields: url.Values{"user": {"user"}, "password": {tt.password}}})
+			err := d.login()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Downloader.login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "403") {
+				t.Errorf("Downloader.login() error = %v", err)
+			}
+			req, _ := d.newRequest(ts.URL + "/private.html")
+			resp, err := d.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("http status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// login form posted before any crawl request (root urls queued before start)
+func TestDownloader_loginBeforeCrawl(t *testing.T) {
+	var lock sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		lock.Unlock()
+		switch req.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+			http.Redirect(w, req, "/", http.StatusFound)
+		case "/robots.txt":
+			http.NotFound(w, req)
+		default:
+			if c, err := req.Cookie("session"); err != nil || c.Value != "s1" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, "private")
+		}
+	}))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	d := NewDownloader(FlatMode, 1, time.Second, 1)
+	d.SetLoginForm(&LoginForm{URL: ts.URL + "/login", Fields: url.Values{"user": {"user"}}})
+	for _, path := range []string{"/1.txt", "/2.txt", "/3.txt"} {
+		d.AddRootURL(ts.URL+path, 1, 0, 0)
+	}
+	if _, err = d.NewLoad(tmpdir+"/out", "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.SetParallel(3).Run(context.Background()); err != nil {
+		t.Fatalf("Downloader.Run() error = %v", err)
+	}
+	if len(requests) == 0 || requests[0] != "POST /login" {
+		t.Fatalf("Downloader requests = %v, want login first", requests)
+	}
+	for _, path := range []string{"/1.txt", "/2.txt", "/3.txt"} {
+		if task := d.taskByURL(ts.URL + path); task == nil || task.status != TaskOK {
+			t.Errorf("%s not downloaded", path)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package downloader
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+// BrokenLink not found (or failed) url with page and tag, where link found
+type BrokenLink struct {
+	URL        string
+	Referrer   string // page, where link found (blank for root url)
+	Tag        string // element name (or style, css), where link found
+	Attr       string // attribute name, where link found
+	HTTPStatus int    // last response http status (0 on connection error)
+	Err        error
+}
+
+// CheckLoad builder for check links (spider without saving files and map)
+func (d *Downloader) CheckLoad() (*Downloader, error) {
+	if d.processed.Len() == 0 {
+		return nil, errors.New("root url not set")
+	}
+	d.check = true
+	return d, nil
+}
+
+// isParsed check for content type, parsed for links (html with exhausted links level only checked)
+func isParsed(task *task, contentType string) bool {
+	return contentType == "text/css" || (contentType == "text/html" && task.Links() > 0)
+}
+
+// checkMethod return request method for check link (GET for known html and css, which need parse, HEAD for other)
+func checkMethod(task *task) string {
+	if isParsed(task, task.contentType) {
+		return http.MethodGet
+	}
+	// html and css detected by Content-Type from HEAD response
+	return http.MethodHead
+}
+
+func (d *Downloader) checkRequest(task *task, method string) (*http.Response, error) {
+	if err := d.crawlDelay(task.url); err != nil {
+		return nil, err
+	}
+	req, err := d.newRequest(task.url)
+	if err != nil {
+		return nil, err
+	}
+	req.Method = method
+	return d.client.Do(req)
+}
+
+// httpCheck check link with HEAD request (or GET and parse for html and css)
+func (d *Downloader) httpCheck(task *task) error {
+	method := checkMethod(task)
+	for {
+		resp, err := d.checkRequest(task, method)
+		if err != nil {
+			return err
+		}
+		if method == http.MethodHead && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented ||
+			(resp.StatusCode == http.StatusOK && isParsed(task, mediaType(resp.Header.Get("Content-Type"))))) {
+			// HEAD not allowed or need parse
+			resp.Body.Close()
+			method = http.MethodGet
+			continue
+		}
+		err = d.checkResponse(task, resp, method)
+		resp.Body.Close()
+		return err
+	}
+}
+
+func (d *Downloader) checkResponse(task *task, resp *http.Response, method string) error {
+	task.httpStatus = resp.StatusCode
+	d.observer.TaskResponse(task.info(), resp.StatusCode, resp.Header)
+	if resp.StatusCode == http.StatusNotFound {
+		task.try = 0
+		task.status = TaskNotFound
+		return ErrNotFound
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	task.contentType = mediaType(resp.Header.Get("Content-Type"))
+	task.size = resp.ContentLength
+	if method == http.MethodGet && isParsed(task, task.contentType) {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		task.size = int64(len(data))
+		if task.contentType == "text/css" {
+			err = d.cssSave(data, task, true, d.loadRef(task))
+		} else {
+			err = d.htmlParse(data, task, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	task.status = TaskOK
+	return nil
+}
+
+// BrokenLinks return not found (or failed) links (one for every reference), sorted by referrer and url (call after Wait)
+func (d *Downloader) BrokenLinks() []BrokenLink {
+	errs := d.Errors()
+	links := make([]BrokenLink, 0, len(errs))
+	if len(errs) == 0 {
+		return links
+	}
+	refs := make(map[string][]*edge)
+	for kv := range d.edges.Iter() {
+		e := kv.Value.(*edge)
+		key := d.canonicalizer.Key(e.url)
+		refs[key] = append(refs[key], e)
+	}
+	for _, e := range errs {
+		link := BrokenLink{URL: e.URL, Err: e.Err}
+		if task := d.taskByURL(e.URL); task != nil {
+			link.Referrer = task.referrer
+			link.Tag = task.tag
+			link.Attr = task.attr
+			link.HTTPStatus = task.httpStatus
+		}
+		if edges := refs[d.canonicalizer.Key(e.URL)]; len(edges) > 0 {
+			for _, edge := range edges {
+				link.Referrer = edge.referrer
+				link.Tag = edge.tag
+				link.Attr = edge.attr
+				links = append(links, link)
+			}
+		} else {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Referrer == links[j].Referrer {
+			return links[i].URL < links[j].URL
+		}
+		return links[i].Referrer < links[j].Referrer
+	})
+	return links
+}
@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloader_Check(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		methods = make(map[string][]string)
+	)
+	handler := testHandler()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		methods[req.URL.Path] = append(methods[req.URL.Path], req.Method)
+		lock.Unlock()
+		handler.ServeHTTP(w, req)
+	}))
+	defer ts.Close()
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	d := NewDownloader(FlatMode, 1, time.Second, 2)
+	d.AddRootURL(baseAddr+"/index.html", 2, 0, 0)
+	if _, err := d.CheckLoad(); err != nil {
+		t.Fatal(err)
+	}
+	d.Start(2)
+	// not_found.html is broken
+	if failed := d.Wait(); !failed {
+		t.Errorf("Downloader.Wait() = %v, want %v", failed, true)
+	}
+
+	wantMethods := map[string][]string{
+		// pages parsed for links
+		"/index.html":     {"HEAD", "GET"},
+		"/link1.html":     {"HEAD", "GET"},
+		"/not_found.html": {"HEAD"},
+		// linked binary
+		"/1.gz":  {"HEAD"},
+		"/1.gif": {"HEAD"},
+		// stylesheet parsed for links
+		"/style.css": {"HEAD", "GET"},
+		// links level exhausted, checked without parse
+		"/link2.html": {"HEAD"},
+	}
+	for path, want := range wantMethods {
+		got := methods[path]
+		if len(got) != len(want) {
+			t.Errorf("%s requests = %v, want %v", path, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s requests = %v, want %v", path, got, want)
+				break
+			}
+		}
+	}
+	// referenced from index.html and link1.html
+	links := d.BrokenLinks()
+	want := []BrokenLink{
+		{URL: baseAddr + "/not_found.html", Referrer: baseAddr + "/index.html", Tag: "a", Attr: "href", HTTPStatus: 404, Err: ErrNotFound},
+		{URL: baseAddr + "/not_found.html", Referrer: baseAddr + "/link1.html", Tag: "a", Attr: "href", HTTPStatus: 404, Err: ErrNotFound},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("Downloader.BrokenLinks() = %+v, want %+v", links, want)
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("Downloader.BrokenLinks()[%d] = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+
+	for _, url := range []string{"/index.html", "/style.css", "/1.gif", "/link2.html"} {
+		task := d.taskByURL(baseAddr + url)
+		if task == nil {
+			t.Errorf("%s not processed", url)
+		} else if task.status != TaskOK || len(task.fileName) > 0 {
+			t.Errorf("%s status = %s, file '%s', want %s without file", url, task.status, task.fileName, TaskOK)
+		}
+	}
+}
+
+func TestDownloader_CheckLevel(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		methods = make(map[string][]string)
+	)
+	handler := testHandler()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		methods[req.URL.Path] = append(methods[req.URL.Path], req.Method)
+		lock.Unlock()
+		handler.ServeHTTP(w, req)
+	}))
+	defer ts.Close()
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	// links from index.html on last level
+	d := NewDownloader(FlatMode, 1, time.Second, 2)
+	d.AddRootURL(baseAddr+"/index.html", 1, 0, 0)
+	if _, err := d.CheckLoad(); err != nil {
+		t.Fatal(err)
+	}
+	d.Start(2)
+	if failed := d.Wait(); !failed {
+		t.Errorf("Downloader.Wait() = %v, want %v", failed, true)
+	}
+
+	for _, path := range []string{"/link1.html", "/not_found.html", "/1.gz"} {
+		if got := methods[path]; len(got) != 1 || got[0] != "HEAD" {
+			t.Errorf("%s requests = %v, want %v", path, got, []string{"HEAD"})
+		}
+	}
+
+	links := d.BrokenLinks()
+	want := []BrokenLink{
+		{URL: baseAddr + "/not_found.html", Referrer: baseAddr + "/index.html", Tag: "a", Attr: "href", HTTPStatus: 404, Err: ErrNotFound},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("Downloader.BrokenLinks() = %+v, want %+v", links, want)
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("Downloader.BrokenLinks()[%d] = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/msaf1980/godownloader/pkg/urlutils"
+)
+
+// refRewriter return new reference for absolute url (and true, if reference must be rewritten),
+// src is element and attribute, where reference found (referrer is set by rewriter).
+// Blank reference for <base href> remove it.
+type refRewriter func(absURL string, ref string, src linkSource, needLoad bool, pageContent bool) (string, bool)
+
+// loadRef queue references from task and rewrite not loaded to absolute urls
+func (d *Downloader) loadRef(task *task) refRewriter {
+	baseHost, _ := urlutils.SplitURL(task.url)
+	baseLevel := task.Links()
+	baseDownLevel := task.DownLevel()
+	baseExtLevel := task.ExtLinks()
+
+	return func(absURL string, ref string, src linkSource, needLoad bool, pageContent bool) (string, bool) {
+		src.referrer = task.url
+		if needLoad && d.addURL(absURL, pageContent, d.retry, baseHost, task.rootDir, task.root, src, baseLevel, baseDownLevel, baseExtLevel) {
+			return ref, false
+		}
+		return absURL, true
+	}
+}
+
+// localRef rewrite references from task to downloaded files with relative local paths (and other to absolute urls)
+func (d *Downloader) localRef(task *task) refRewriter {
+	return func(absURL string, ref string, src linkSource, needLoad bool, pageContent bool) (string, bool) {
+		if src.tag == "base" {
+			// links converted to local paths
+			return "", true
+		}
+		if p, ok := d.localPath(task, absURL); ok {
+			return p, true
+		}
+		return absURL, true
+	}
+}
+
+// relPath return path to file, relative to dir of from file
+func relPath(from string, to string) string {
+	fromDirs := strings.Split(path.Dir(from), "/")
+	if len(fromDirs) == 1 && fromDirs[0] == "." {
+		fromDirs = nil
+	}
+	toDirs := strings.Split(to, "/")
+	i := 0
+	for i < len(fromDirs) && i < len(toDirs)-1 && fromDirs[i] == toDirs[i] {
+		i++
+	}
+	var sb strings.Builder
+	for k := i; k < len(fromDirs); k++ {
+		sb.WriteString("../")
+	}
+	sb.WriteString(strings.Join(toDirs[i:], "/"))
+	u := url.URL{Path: sb.String()}
+	return u.String()
+}
+
+// localPath return path to downloaded file for url, relative to task file
+func (d *Downloader) localPath(task *task, absURL string) (string, bool) {
+	stripURL := urlutils.StripAnchor(absURL)
+	t := d.taskByURL(stripURL)
+	if t == nil || t.status != TaskOK || len(t.fileName) == 0 {
+		return "", false
+	}
+	return relPath(task.fileName, t.fileName) + absURL[len(stripURL):], true
+}
+
+// convertTask rewrite references in downloaded html or css file to relative local paths
+func (d *Downloader) convertTask(task *task) error {
+	data, err := ioutil.ReadFile(d.outdir + "/" + task.fileName)
+	if err != nil {
+		return err
+	}
+	if task.contentType == "text/css" {
+		return d.cssSave(data, task, false, d.localRef(task))
+	}
+	return d.htmlRewrite(data, task, false, d.localRef(task))
+}
+
+// convertFiles rewrite references in downloaded html and css files to relative local paths (for offline browsing)
+func (d *Downloader) convertFiles() {
+	n := 0
+	for kv := range d.processed.Iter() {
+		task := kv.Value.(*task)
+		if task.status != TaskOK || len(task.fileName) == 0 ||
+			(task.contentType != "text/html" && task.contentType != "text/css") {
+			continue
+		}
+		if err := d.convertTask(task); err != nil {
+			d.taskError(task, err)
+			d.logger.Error().Str("url", task.url).Str("file", task.fileName).Msg(err.Error())
+			continue
+		}
+		n++
+	}
+	d.logger.Info().Int("files", n).Msg("links converted")
+}
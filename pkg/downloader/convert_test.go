@@ -0,0 +1,163 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msaf1980/godownloader/pkg/urlutils"
+)
+
+func Test_relPath(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want string
+	}{
+		{"index.html", "link1.html", "link1.html"},
+		{"index.html", "index.html", "index.html"},
+		{"index.html", "css/style.css", "css/style.css"},
+		{"css/style.css", "img/1.gif", "../img/1.gif"},
+		{"test.int/a/b/index.html", "test.int/a/c/1.gif", "../c/1.gif"},
+		{"test.int/index.html", "test2.int/index.html", "../test2.int/index.html"},
+		{"test.int/a/index.html", "test.int/a", "../a"},
+		{"index.html", "al.com_8080/a b.html", "al.com_8080/a%20b.html"},
+		{"index.html", "a:b.html", "./a:b.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" "+tt.to, func(t *testing.T) {
+			if got := relPath(tt.from, tt.to); got != tt.want {
+				t.Errorf("relPath() = '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
+
+var convertRefRe = regexp.MustCompile(`(?:href|src)="([^"]*)"|url\(([^)]*)\)`)
+
+// verifyConverted check, that references in converted files point to local files (or not downloaded urls)
+func verifyConverted(t *testing.T, outdir string, notLoaded map[string]bool) int {
+	refs := 0
+	err := filepath.Walk(outdir, func(fileName string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(fileName)
+		if info.IsDir() || (ext != ".html" && ext != ".css") {
+			return nil
+		}
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		for _, m := range convertRefRe.FindAllStringSubmatch(string(data), -1) {
+			ref := m[1] + strings.Trim(m[2], `"'`)
+			if len(ref) == 0 || ref[0] == '#' {
+				continue
+			}
+			refs++
+			if strings.Contains(ref, "://") {
+				if !notLoaded[urlutils.StripAnchor(ref)] {
+					t.Errorf("%s: reference '%s' not converted", fileName, ref)
+				}
+				continue
+			}
+			u, err := url.Parse(ref)
+			if err != nil {
+				t.Errorf("%s: reference '%s' invalid: %v", fileName, ref, err)
+				continue
+			}
+			target := filepath.Join(filepath.Dir(fileName), filepath.FromSlash(u.Path))
+			if _, err := os.Stat(target); err != nil {
+				t.Errorf("%s: reference '%s' not found: %v", fileName, ref, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refs
+}
+
+func TestDownloader_convertLinks(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+	notLoaded := map[string]bool{
+		baseAddr + "/not_found.html": true,
+		baseAddr + "/feed.xml":       true,
+	}
+
+	for _, saveMode := range []SaveMode{SiteDirMode, DirMode, FlatMode, FlatDirMode} {
+		t.Run(saveMode.String(), func(t *testing.T) {
+			tmpdir, err := ioutil.TempDir("", "godownloader-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpdir)
+			dir := tmpdir + "/" + "out"
+
+			d := NewDownloader(saveMode, 1, time.Second, 2).SetConvertLinks(true)
+			d.AddRootURL(baseAddr+"/index.html", 3, 0, 0)
+			if _, err = d.NewLoad(dir, "godownloader.map"); err != nil {
+				t.Fatal(err)
+			}
+			d.Start(2)
+			d.Wait()
+
+			for _, url := range []string{"/index.html", "/link1.html", "/link2.html", "/style.css", "/1.gif", "/1.gz"} {
+				task := d.taskByURL(baseAddr + url)
+				if task == nil || task.status != TaskOK {
+					t.Fatalf("%s not downloaded", url)
+				}
+			}
+			if refs := verifyConverted(t, dir, notLoaded); refs == 0 {
+				t.Errorf("references not found")
+			}
+		})
+	}
+}
+
+func TestDownloader_convertLinksBase(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	d := NewDownloader(FlatMode, 1, time.Second, 2).SetConvertLinks(true)
+	d.AddRootURL(baseAddr+"/docs/x/base.html", 1, 0, 0)
+	if _, err = d.NewLoad(tmpdir+"/out", "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	d.Start(1)
+	d.Wait()
+
+	task := d.taskByURL(baseAddr + "/docs/x/base.html")
+	if task == nil || task.status != TaskOK {
+		t.Fatal("/docs/x/base.html not downloaded")
+	}
+	data, err := ioutil.ReadFile(tmpdir + "/out/" + task.fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// links converted to local paths, so base href removed (original url saved in tppabs)
+	if strings.Contains(string(data), `<base href=`) {
+		t.Errorf("base href not removed:\n%s", string(data))
+	}
+	if !strings.Contains(string(data), `<base tppabs="`+baseAddr+`/docs/">`) {
+		t.Errorf("base tppabs not set:\n%s", string(data))
+	}
+}
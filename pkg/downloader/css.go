@@ -0,0 +1,268 @@
+package downloader
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/msaf1980/godownloader/pkg/urlutils"
+)
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isCSSIdent(c byte) bool {
+	return c == '-' || c == '_' || c == '\\' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func skipCSSSpaces(css string, i int) int {
+	for i < len(css) && isCSSSpace(css[i]) {
+		i++
+	}
+	return i
+}
+
+// cssStringEnd return position after closing quote of css string, started at i
+func cssStringEnd(css string, i int) int {
+	quote := css[i]
+	i++
+	for i < len(css) {
+		switch css[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			// unclosed string
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+// hasPrefixFold check for case-insensitive prefix at position i
+func hasPrefixFold(css string, i int, prefix string) bool {
+	return len(css)-i >= len(prefix) && strings.EqualFold(css[i:i+len(prefix)], prefix)
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// cssUnescape decode css escapes (\' or \( and hex escapes like \20 ) in string or url()
+func cssUnescape(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		if isHexDigit(s[i]) {
+			end := i
+			for end < len(s) && end-i < 6 && isHexDigit(s[end]) {
+				end++
+			}
+			r, _ := strconv.ParseUint(s[i:end], 16, 32)
+			if r == 0 || r > utf8.MaxRune {
+				r = utf8.RuneError
+			}
+			sb.WriteRune(rune(r))
+			if end < len(s) && isCSSSpace(s[end]) {
+				end++
+			}
+			i = end - 1
+		} else if s[i] != '\n' {
+			// escaped newline is line continuation
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// quoteCSSURL format url() argument (quote it, if needed)
+func quoteCSSURL(ref string, quote byte) string {
+	if quote == 0 {
+		if !strings.ContainsAny(ref, " \t\n\r\f()'\"\\") {
+			return ref
+		}
+		quote = '"'
+	}
+	q := string(quote)
+	return q + strings.NewReplacer("\\", "\\\\", q, "\\"+q).Replace(ref) + q
+}
+
+const cssAbsPrefix = "/*tppabs="
+
+// cssAbsComment format comment with absolute url for converted reference (blank for absURL)
+func cssAbsComment(absURL string) string {
+	if len(absURL) == 0 {
+		return ""
+	}
+	return cssAbsPrefix + strings.NewReplacer("*/", "*%2F", "\"", "%22", "'", "%27").Replace(absURL) + "*/"
+}
+
+// cssAbsURL return absolute url from comment at position i (after converted reference) and position after comment
+func cssAbsURL(css string, i int) (string, int) {
+	if !strings.HasPrefix(css[i:], cssAbsPrefix) {
+		return "", i
+	}
+	end := strings.Index(css[i+len(cssAbsPrefix):], "*/")
+	if end == -1 {
+		return "", i
+	}
+	return css[i+len(cssAbsPrefix) : i+len(cssAbsPrefix)+end], i + len(cssAbsPrefix) + end + 2
+}
+
+// cssRewrite find url() and @import references in css and replace them with rewrite result (if changed).
+// absURL is url from tppabs comment after reference (in converted css), rewrite return new reference and
+// absolute url for comment (blank for remove comment).
+func cssRewrite(css string, rewrite func(ref string, absURL string) (string, string, bool)) (string, bool) {
+	var sb strings.Builder
+	changed := false
+	last := 0
+	// replace reference in css[start:end] (with quote or unquoted for quote == 0), after is position after url() or @import string
+	replace := func(start, end, after int, ref string, quote byte) {
+		ref = cssUnescape(ref)
+		absURL, commentEnd := cssAbsURL(css, after)
+		newRef, newAbsURL, ok := rewrite(ref, absURL)
+		if !ok || (newRef == ref && newAbsURL == absURL) {
+			return
+		}
+		sb.WriteString(css[last:start])
+		sb.WriteString(quoteCSSURL(newRef, quote))
+		sb.WriteString(css[end:after])
+		sb.WriteString(cssAbsComment(newAbsURL))
+		last = commentEnd
+		changed = true
+	}
+	// parse url(...) at position i (after "url("), return position after it
+	parseURL := func(i int) int {
+		i = skipCSSSpaces(css, i)
+		if i == len(css) {
+			return i
+		}
+		if css[i] == '"' || css[i] == '\'' {
+			start := i
+			end := cssStringEnd(css, i)
+			if end > start+1 && css[end-1] == css[start] {
+				after := skipCSSSpaces(css, end)
+				if after < len(css) && css[after] == ')' {
+					after++
+				} else {
+					after = end
+				}
+				replace(start, end, after, css[start+1:end-1], css[start])
+			}
+			return end
+		}
+		start := i
+		for i < len(css) && css[i] != ')' {
+			if css[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i > len(css) {
+			i = len(css)
+		}
+		ref := strings.TrimRight(css[start:i], " \t\n\r\f")
+		if len(ref) > 0 {
+			after := i
+			if after < len(css) {
+				after++
+			}
+			replace(start, start+len(ref), after, ref, 0)
+		}
+		return i
+	}
+
+	i := 0
+	for i < len(css) {
+		c := css[i]
+		switch {
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				i = len(css)
+			} else {
+				i += end + 4
+			}
+		case c == '"' || c == '\'':
+			i = cssStringEnd(css, i)
+		case c == '@' && hasPrefixFold(css, i, "@import") && (i+7 == len(css) || !isCSSIdent(css[i+7])):
+			i = skipCSSSpaces(css, i+7)
+			if i < len(css) && (css[i] == '"' || css[i] == '\'') {
+				start := i
+				i = cssStringEnd(css, i)
+				if i > start+1 && css[i-1] == css[start] {
+					replace(start, i, i, css[start+1:i-1], css[start])
+				}
+			}
+		case (c == 'u' || c == 'U') && hasPrefixFold(css, i, "url(") && (i == 0 || !isCSSIdent(css[i-1])):
+			i = parseURL(i + 4)
+		default:
+			i++
+		}
+	}
+	if !changed {
+		return css, false
+	}
+	sb.WriteString(css[last:])
+	return sb.String(), true
+}
+
+// cssParse rewrite url() and @import references from css (found in src) with rewrite result
+func (d *Downloader) cssParse(css string, baseURL string, task *task, src linkSource, rewrite refRewriter) (string, bool) {
+	return cssRewrite(css, func(ref string, absURL string) (string, string, bool) {
+		if !isLinkRef(ref) {
+			return ref, absURL, false
+		}
+		if len(absURL) == 0 {
+			// not a converted link
+			absURL = urlutils.AbsURL(ref, baseURL)
+		}
+		newRef, ok := rewrite(absURL, ref, src, true, true)
+		if !ok {
+			return ref, absURL, false
+		}
+		if newRef == absURL {
+			return newRef, "", true
+		}
+		// save absolute url for converted reference
+		return newRef, absURL, true
+	})
+}
+
+// cssSave rewrite stylesheet references and save it (if changed or on first parse)
+func (d *Downloader) cssSave(data []byte, task *task, firstParse bool, rewrite refRewriter) error {
+	css, changed := d.cssParse(string(data), task.url, task, linkSource{tag: "css"}, rewrite)
+	if (!changed && !firstParse) || d.check {
+		return nil
+	}
+	fileName := d.outdir + "/" + task.fileName
+	tmpfile := fileName + ".part"
+	err := ioutil.WriteFile(tmpfile, []byte(css), 0644)
+	if err == nil {
+		err = os.Rename(tmpfile, fileName)
+	}
+	return err
+}
+
+// Load the stylesheet
+func (d *Downloader) cssLoad(body io.Reader, task *task) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return d.cssSave(data, task, true, d.loadRef(task))
+}
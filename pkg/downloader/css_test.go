@@ -0,0 +1,222 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_cssRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		css      string
+		wantRefs []string
+		want     string
+	}{
+		{
+			name:     "url",
+			css:      `body { background: url(img/bg.png) no-repeat; } td { background: URL( "img/td.png" ) }`,
+			wantRefs: []string{"img/bg.png", "img/td.png"},
+			want:     `body { background: url(http://test.int/img/bg.png) no-repeat; } td { background: URL( "http://test.int/img/td.png" ) }`,
+		},
+		{
+			name:     "import",
+			css:      "@import 'base.css' screen;\n@IMPORT url(\"print.css\") print;\n@importer 'no.css';",
+			wantRefs: []string{"base.css", "print.css"},
+			want:     "@import 'http://test.int/base.css' screen;\n@IMPORT url(\"http://test.int/print.css\") print;\n@importer 'no.css';",
+		},
+		{
+			name:     "font-face",
+			css:      `@font-face { src: url('fonts/a.woff2') format("woff2"), url(fonts/a.woff) format("woff"); }`,
+			wantRefs: []string{"fonts/a.woff2", "fonts/a.woff"},
+			want:     `@font-face { src: url('http://test.int/fonts/a.woff2') format("woff2"), url(http://test.int/fonts/a.woff) format("woff"); }`,
+		},
+		{
+			name:     "comments and strings",
+			css:      `/* url(comment.png) */ a::before { content: "url(string.png)"; } a { b: myurl(x.png) }`,
+			wantRefs: nil,
+			want:     `/* url(comment.png) */ a::before { content: "url(string.png)"; } a { b: myurl(x.png) }`,
+		},
+		{
+			name:     "quote unquoted",
+			css:      `a { background: url(img/a b.png) }`,
+			wantRefs: []string{"img/a b.png"},
+			want:     `a { background: url("http://test.int/img/a b.png") }`,
+		},
+		{
+			name:     "escapes",
+			css:      `a { background: url('img/a\'b.png') } b { background: url(img/a\(b.png) } c { background: url("img/a\\b\20 c.png") }`,
+			wantRefs: []string{`img/a'b.png`, `img/a(b.png`, `img/a\b c.png`},
+			want:     `a { background: url('http://test.int/img/a\'b.png') } b { background: url("http://test.int/img/a(b.png") } c { background: url("http://test.int/img/a\\b c.png") }`,
+		},
+		{
+			name:     "unclosed",
+			css:      `a { background: url(img/a.png`,
+			wantRefs: []string{"img/a.png"},
+			want:     `a { background: url(http://test.int/img/a.png`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var refs []string
+			got, changed := cssRewrite(tt.css, func(ref string, absURL string) (string, string, bool) {
+				refs = append(refs, ref)
+				return "http://test.int/" + ref, "", true
+			})
+			if strings.Join(refs, " ") != strings.Join(tt.wantRefs, " ") {
+				t.Errorf("cssRewrite() refs = %q, want %q", refs, tt.wantRefs)
+			}
+			if changed != (len(tt.wantRefs) > 0) {
+				t.Errorf("cssRewrite() changed = %v", changed)
+			}
+			if got != tt.want {
+				t.Errorf("cssRewrite() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cssRewriteAbsURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		css         string
+		wantAbsURLs []string
+		want        string
+	}{
+		{
+			name:        "convert",
+			css:         `a { background: url(img/a.png) } b { background: url( "img/b.png" ) }`,
+			wantAbsURLs: []string{"", ""},
+			want:        `a { background: url(a.png)/*tppabs=http://test.int/img/a.png*/ } b { background: url( "b.png" )/*tppabs=http://test.int/img/b.png*/ }`,
+		},
+		{
+			name:        "converted",
+			css:         "@import 'base.css'/*tppabs=http://test.int/css/base.css*/;\na { background: url(a.png)/*tppabs=http://test.int/img/a.png*/ }",
+			wantAbsURLs: []string{"http://test.int/css/base.css", "http://test.int/img/a.png"},
+			want:        "@import 'base.css'/*tppabs=http://test.int/css/base.css*/;\na { background: url(a.png)/*tppabs=http://test.int/img/a.png*/ }",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var absURLs []string
+			got, _ := cssRewrite(tt.css, func(ref string, absURL string) (string, string, bool) {
+				absURLs = append(absURLs, absURL)
+				if len(absURL) == 0 {
+					absURL = "http://test.int/" + ref
+				}
+				return path.Base(ref), absURL, true
+			})
+			if strings.Join(absURLs, " ") != strings.Join(tt.wantAbsURLs, " ") {
+				t.Errorf("cssRewrite() absURLs = %q, want %q", absURLs, tt.wantAbsURLs)
+			}
+			if got != tt.want {
+				t.Errorf("cssRewrite() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloader_httpLoadCSS(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	d := NewDownloader(DirMode, 1, time.Second, 2)
+	d.AddRootURL("http://127.0.0.1/", 1, 0, 0)
+	_, err = d.NewLoad(tmpdir+"/out", "godownloader.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	tests := []struct {
+		task  *task
+		orig  string
+		links []string
+	}{
+		{
+			newLoadTask(baseAddr+"/css.html", "/", 1, 0, 0, 1), "test/css.html.tpl",
+			[]string{
+				baseAddr + "/css/main.css", baseAddr + "/img/Inline.png", baseAddr + "/img/attr.png",
+			},
+		},
+		{
+			newLoadTask(baseAddr+"/css/main.css", "/", 1, 0, 0, 1), "test/css/main.css",
+			[]string{
+				baseAddr + "/css/base.css", baseAddr + "/img/bg.png", baseAddr + "/css/fonts/a.woff2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.task.url, func(t *testing.T) {
+			if err = d.httpLoad(tt.task); err != nil {
+				t.Fatalf("Downloader.httpLoad() error = '%v'", err)
+			}
+			verifyFile(t, d.outdir, tt.task.fileName, tt.orig, baseAddr)
+			for _, url := range tt.links {
+				if _, ok := d.processed.Get(url); !ok {
+					t.Errorf("Downloader.httpLoad() link %s not extracted", url)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloader_cssSameFileNames(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	// img/a.png loaded before css/main.css, so local name a.png is already used
+	d := NewDownloader(FlatMode, 1, time.Second, 2).SetConvertLinks(true)
+	d.AddRootURL(baseAddr+"/flat/index.html", 1, 0, 0)
+	if _, err = d.NewLoad(tmpdir+"/out", "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	d.Start(1)
+	d.Wait()
+
+	for _, u := range []string{"/flat/index.html", "/flat/img/a.png", "/flat/css/main.css", "/flat/css/a.png"} {
+		if task := d.taskByURL(baseAddr + u); task == nil || task.status != TaskOK {
+			t.Errorf("%s not downloaded", u)
+		}
+	}
+	css := d.taskByURL(baseAddr + "/flat/css/main.css")
+	img := d.taskByURL(baseAddr + "/flat/css/a.png")
+	if css == nil || img == nil {
+		t.FailNow()
+	}
+	data, err := ioutil.ReadFile(tmpdir + "/out/" + css.fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "url(" + img.fileName + ")/*tppabs=" + img.url + "*/"
+	if !strings.Contains(string(data), want) {
+		t.Errorf("%s not converted to %s:\n%s", css.fileName, want, string(data))
+	}
+
+	// converted again (on continue)
+	d.convertFiles()
+	if data, err = ioutil.ReadFile(tmpdir + "/out/" + css.fileName); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), want) {
+		t.Errorf("%s not converted again to %s:\n%s", css.fileName, want, string(data))
+	}
+}
@@ -1,7 +1,9 @@
 package downloader
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -10,10 +12,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/msaf1980/godownloader/pkg/cookies"
 	"github.com/msaf1980/godownloader/pkg/mimetypes"
+	"github.com/msaf1980/godownloader/pkg/urlutils"
 
 	"github.com/cornelk/hashmap"
-	lockfree_queue "github.com/msaf1980/go-lockfree-queue"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
@@ -85,8 +89,22 @@ func replaceExtension(path string, contentType string) (string, string, string)
 	return name + ext, name, ext
 }
 
+// DefaultUserAgent default User-Agent header
+const DefaultUserAgent = "godownloader"
+
+// CookiesFile cookies file (in Netscape cookies.txt format) in output dir
+const CookiesFile = "godownloader.cookies"
+
 // Downloader downloader instance
 type Downloader struct {
+	bytes     int64        // atomic downloaded bytes (for quota), first for 64-bit alignment
+	fileCount int64        // atomic downloaded files (for quota)
+	counters  taskCounters // atomic task results counters (for stats)
+
+	logger zerolog.Logger
+
+	parallel int // workers count for Run
+
 	saveMode SaveMode
 
 	timeout time.Duration
@@ -94,20 +112,62 @@ type Downloader struct {
 
 	maxRedirects int
 
-	queue *lockfree_queue.Queue // task queue
+	client  *http.Client
+	headers http.Header  // default request headers
+	jar     *cookies.Jar // cookies, saved in output dir
+
+	auth      map[string]*hostAuth // credentials by host
+	loginForm *LoginForm
+
+	userAgent    string
+	ignoreRobots bool
+	robots       *hashmap.HashMap // lock-free map[host]*hostRobots - robots.txt rules by host
+
+	hostLimits    HostLimits            // default per host limits
+	urlHostLimits map[string]HostLimits // per host limits (for root urls)
+	filters       map[string]*urlFilter // accept/reject filters by root url
+	hosts         *hashmap.HashMap      // lock-free map[host]*hostLimiter
+
+	quotas Quotas // download limits
+
+	observer Observer // task lifecycle events receiver
+
+	canonicalizer urlutils.Canonicalizer // url canonicalization rules for processed map
+
+	queue *scheduler // task queue
 
 	//processLock sync.Mutex       // set when check for existing/insert during add new task
 	processed *hashmap.HashMap // lock-free map[url]*task - processed tasks by url
 	filesLock sync.Mutex       // set when generate/insert new filename for task
 	files     *hashmap.HashMap // lock-free map[filename]*task - processed tasks by filename
+	skipped   *hashmap.HashMap // lock-free map[url]*task - urls, skipped by level or filters (for report)
+	edges     *hashmap.HashMap // lock-free map[referrer url tag attr]*edge - references (for link graph)
 
 	fileMap string // map
 	fMap    *os.File
 
+	update bool // refresh downloaded files with conditional requests
+
+	convertLinks bool // rewrite links to relative local paths after download
+
+	check bool // check links only (HEAD requests where possible, no files saved)
+
+	ctx    context.Context    // canceled on abort (for interrupt running requests)
+	cancel context.CancelFunc // abort running requests
+
+	errsLock  sync.Mutex     // set when save errors, read run times or workers
+	workers   []atomic.Value // current url by worker (for progress)
+	errs      Errors         // url errors
+	err       error          // first not url error
+	startTime time.Time
+	endTime   time.Time
+
 	wg       sync.WaitGroup
-	running  bool
-	download int32
-	failed   bool
+	started  int32 // atomic, set 1 on start
+	running  int32 // atomic, set 0 on abort
+	download int32 // atomic, running tasks count
+	deferred int32 // tasks, deferred by host limits
+	failed   int32 // atomic, set 1 on any task error or abort
 
 	outdir string
 }
@@ -117,13 +177,74 @@ func NewDownloader(saveMode SaveMode, retry int, timeout time.Duration, maxRedir
 	if retry <= 0 {
 		retry = 1
 	}
-	return &Downloader{saveMode: saveMode, retry: retry, timeout: timeout, maxRedirects: maxRedirects,
+	d := &Downloader{saveMode: saveMode, retry: retry, timeout: timeout, maxRedirects: maxRedirects,
 		processed: &hashmap.HashMap{},
 		files:     &hashmap.HashMap{},
-		queue:     lockfree_queue.NewQueue(4096),
+		skipped:   &hashmap.HashMap{},
+		edges:     &hashmap.HashMap{},
+		robots:    &hashmap.HashMap{},
+		hosts:     &hashmap.HashMap{},
+		userAgent: DefaultUserAgent,
+		jar:       cookies.New(),
+		queue:     newScheduler(),
 		//root:      list.New(),
-		running: true,
+		urlHostLimits: make(map[string]HostLimits),
+		filters:       make(map[string]*urlFilter),
+		running:       1,
+		logger:        log.Logger,
+		parallel:      1,
+		observer:      NopObserver{},
 	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	// default settings, no errors
+	_ = d.SetHTTPConfig(DefaultHTTPConfig())
+	return d
+}
+
+// SetUserAgent set User-Agent header (also used for robots.txt rules)
+func (d *Downloader) SetUserAgent(userAgent string) *Downloader {
+	if len(userAgent) > 0 {
+		d.userAgent = userAgent
+	}
+	return d
+}
+
+// SetRoundRobin enable per host round-robin scheduling (else all hosts in one queue)
+func (d *Downloader) SetRoundRobin(roundRobin bool) *Downloader {
+	d.queue.SetRoundRobin(roundRobin)
+	return d
+}
+
+// SetIgnoreRobots disable robots.txt check
+func (d *Downloader) SetIgnoreRobots(ignoreRobots bool) *Downloader {
+	d.ignoreRobots = ignoreRobots
+	return d
+}
+
+// SetCanonicalizer set url canonicalization rules (for deduplicate processed urls)
+func (d *Downloader) SetCanonicalizer(canonicalizer urlutils.Canonicalizer) *Downloader {
+	d.canonicalizer = canonicalizer
+	return d
+}
+
+// SetLogger set logger (global zerolog logger by default)
+func (d *Downloader) SetLogger(logger zerolog.Logger) *Downloader {
+	d.logger = logger
+	return d
+}
+
+// SetParallel set workers count for Run
+func (d *Downloader) SetParallel(parallel int) *Downloader {
+	if parallel > 0 {
+		d.parallel = parallel
+	}
+	return d
+}
+
+// SetConvertLinks rewrite links in downloaded html and css files to relative local paths after download
+func (d *Downloader) SetConvertLinks(convertLinks bool) *Downloader {
+	d.convertLinks = convertLinks
+	return d
 }
 
 // NewLoad builder for new load
@@ -161,91 +282,161 @@ func (d *Downloader) ExistingLoad(dir string, fileMap string) (*Downloader, erro
 	if err != nil {
 		return nil, err
 	}
+	// resume cookies session
+	err = d.jar.LoadFile(dir + "/" + CookiesFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
 	return d, nil
 }
 
-// Abort set stop flag (but need wait for end running goroutines)
+// LoadCookies import cookies from Netscape cookies.txt file
+func (d *Downloader) LoadCookies(fileName string) error {
+	return d.jar.LoadFile(fileName)
+}
+
+// UpdateLoad builder for refresh existing load (conditional requests for downloaded files)
+func (d *Downloader) UpdateLoad(dir string, fileMap string) (*Downloader, error) {
+	d.update = true
+	return d.ExistingLoad(dir, fileMap)
+}
+
+// Abort set stop flag and cancel running requests (but need wait for end running goroutines), safe for concurrent use
 func (d *Downloader) Abort() {
-	if !d.failed {
-		d.failed = true
+	d.setFailed()
+	if atomic.CompareAndSwapInt32(&d.running, 1, 0) {
+		d.cancel()
+		d.queue.Close()
 	}
-	d.running = false
 }
 
-// Wait wait for complete
+// Running check for downloader not aborted
+func (d *Downloader) Running() bool {
+	return atomic.LoadInt32(&d.running) == 1
+}
+
+// setFailed set failed flag
+func (d *Downloader) setFailed() {
+	atomic.StoreInt32(&d.failed, 1)
+}
+
+// Failed check for errors
+func (d *Downloader) Failed() bool {
+	return atomic.LoadInt32(&d.failed) == 1
+}
+
+// Wait wait for complete (or stop after abort), flush map, save cookies and report
 func (d *Downloader) Wait() bool {
 	d.wg.Wait()
+	if d.convertLinks {
+		if d.Running() {
+			d.convertFiles()
+		} else {
+			d.logger.Warn().Msg("aborted, links not converted")
+		}
+	}
 	err := d.closeMap()
 	if err != nil {
-		d.failed = true
-		log.Error().Str("where", "map").Msg(err.Error())
+		d.runError(fmt.Errorf("map: %s", err.Error()))
+		d.logger.Error().Str("where", "map").Msg(err.Error())
 	}
-	return d.failed
+	if len(d.outdir) > 0 {
+		err = d.jar.SaveFile(d.outdir + "/" + CookiesFile)
+		if err != nil {
+			d.runError(fmt.Errorf("cookies: %s", err.Error()))
+			d.logger.Error().Str("where", "cookies").Msg(err.Error())
+		}
+		err = d.SaveReport()
+		if err != nil {
+			d.runError(fmt.Errorf("report: %s", err.Error()))
+			d.logger.Error().Str("where", "report").Msg(err.Error())
+		}
+	}
+	d.errsLock.Lock()
+	if d.endTime.IsZero() && !d.startTime.IsZero() {
+		d.endTime = time.Now()
+	}
+	d.errsLock.Unlock()
+	return d.Failed()
 }
 
-// Start start downloader
+// Start start downloader (errors logged, use Wait for complete)
 func (d *Downloader) Start(parallel int) {
-	if len(d.outdir) == 0 {
-		d.failed = true
-		log.Error().Msg("outdir not set")
-		return
+	if err := d.start(parallel); err != nil {
+		d.logger.Error().Msg(err.Error())
+	}
+}
+
+// start login and start workers
+func (d *Downloader) start(parallel int) error {
+	if !atomic.CompareAndSwapInt32(&d.started, 0, 1) {
+		return ErrStarted
+	}
+	d.errsLock.Lock()
+	d.startTime = time.Now()
+	d.errsLock.Unlock()
+	if len(d.outdir) == 0 && !d.check {
+		err := fmt.Errorf("outdir not set")
+		d.runError(err)
+		return err
+	}
+	if d.loginForm != nil {
+		if err := d.login(); err != nil {
+			err = fmt.Errorf("login %s: %s", d.loginForm.URL, err.Error())
+			d.runError(err)
+			return err
+		}
 	}
+	workers := make([]atomic.Value, parallel)
+	d.errsLock.Lock()
+	d.workers = workers
+	d.errsLock.Unlock()
 	for i := 0; i < parallel; i++ {
-		d.startN("Thread#" + strconv.Itoa(i))
+		workers[i].Store("")
+		d.startN("Thread#"+strconv.Itoa(i), &workers[i])
 	}
+	return nil
 }
 
-func (d *Downloader) startN(thread string) {
+func (d *Downloader) startN(thread string, current *atomic.Value) {
+	d.wg.Add(1)
 	go func(thread string) {
-		idle := 0
-		d.wg.Add(1)
-
 		defer func() {
-			if idle == 0 {
-				atomic.AddInt32(&d.download, -1)
-			}
 			d.wg.Done()
-			log.Debug().Str("Thread", thread).Msg("Exit")
+			d.logger.Debug().Str("Thread", thread).Msg("Exit")
 		}()
 
-		log.Debug().Str("Thread", thread).Msg("Starting")
-
-		atomic.AddInt32(&d.download, 1)
-		for d.running {
-			v, ok := d.queue.Get()
-			if ok {
-				if idle == 1 {
-					idle = 0
-					atomic.AddInt32(&d.download, 1)
-				}
-				t := v.(*task)
-				// check file in processed
-				task, exist := d.addTask(t)
-				if exist {
-					recheck := task.UpdateLinks(t.Links(), t.DownLevel(), t.ExtLinks())
-					if task.success && !recheck {
-						// already downloaded
-						continue
-					}
-				}
-				// run task
-				if task.TryLock() {
-					d.runTask(task)
-				} else {
-					// Task already running, requeue
-					d.queue.Put((task))
-				}
-			} else {
-				if idle == 0 {
-					idle = 1
-					atomic.AddInt32(&d.download, -1)
-				} else {
-					if atomic.LoadInt32(&d.download) == 0 {
-						break
-					}
-				}
-				time.Sleep(200 * time.Millisecond)
+		d.logger.Debug().Str("Thread", thread).Msg("Starting")
+
+		// wait for task, exit when no tasks queued, running or deferred (or on abort)
+		for d.Running() {
+			t, ok := d.queue.Get()
+			if !ok {
+				break
 			}
+			atomic.AddInt32(&d.download, 1)
+			d.processTask(t, current)
+			atomic.AddInt32(&d.download, -1)
+			d.queue.Done(t)
 		}
 	}(thread)
 }
+
+// processTask run task, got from queue (or defer by host limits)
+func (d *Downloader) processTask(t *task, current *atomic.Value) {
+	// check file in processed
+	task, exist := d.addTask(t)
+	if exist {
+		task.UpdateLinks(t.Links(), t.DownLevel(), t.ExtLinks())
+		if task.status == TaskOK && !task.NeedRecheck() && !d.needRefresh(task) {
+			// already downloaded
+			return
+		}
+	}
+	if d.hostAcquire(task) {
+		current.Store(task.url)
+		d.runTask(task)
+		current.Store("")
+		d.hostRelease(task)
+	}
+}
@@ -0,0 +1,99 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDownloader_Abort(t *testing.T) {
+	started := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body><a href="big.bin">Big</a></body></html>`))
+		case "/big.bin":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("ETag", `"big"`)
+			_, _ = w.Write([]byte("part"))
+			w.(http.Flusher).Flush()
+			close(started)
+			// endless download, interrupted by client
+			<-req.Context().Done()
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := tmpdir + "/" + "out"
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	d := NewDownloader(FlatMode, 2, 0, 2)
+	d.AddRootURL(baseAddr+"/index.html", 2, 0, 0)
+	if _, err = d.NewLoad(dir, "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	d.Start(2)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("download not started")
+	}
+	// wait for partial file write
+	for i := 0; i < 100; i++ {
+		if stat, err := os.Stat(dir + "/big.bin.part"); err == nil && stat.Size() == 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	d.Abort()
+	d.Abort() // repeated abort
+	if d.Running() {
+		t.Errorf("Downloader.Running() = true after abort")
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- d.Wait()
+	}()
+	select {
+	case failed := <-done:
+		if !failed {
+			t.Errorf("Downloader.Wait() = false after abort, want true")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Downloader.Wait() not completed after abort")
+	}
+
+	// aborted task not failed and resumed in next run
+	dv := NewDownloader(FlatMode, 2, 0, 2)
+	dv.AddRootURL(baseAddr+"/index.html", 2, 0, 0)
+	if _, err = dv.ExistingLoad(dir, "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	defer dv.closeMap()
+	task := dv.taskByURL(baseAddr + "/big.bin")
+	if task == nil {
+		t.Fatal("aborted task not stored in map")
+	}
+	if task.status != TaskNew || task.try != 2 {
+		t.Errorf("aborted task status = %s, try = %d, want %s, 2", task.status, task.try, TaskNew)
+	}
+	if task.etag != `"big"` {
+		t.Errorf("aborted task etag = '%s', want '%s'", task.etag, `"big"`)
+	}
+	if size := dv.partSize(task); size != 4 {
+		t.Errorf("aborted task part size = %d, want 4", size)
+	}
+}
@@ -0,0 +1,179 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type FilterTarget int8
+
+const (
+	// FilterURL match full url
+	FilterURL FilterTarget = iota
+	// FilterPath match url path
+	FilterPath
+	// FilterHost match url host (without port)
+	FilterHost
+)
+
+var (
+	filterTargetMap = map[string]FilterTarget{"url": FilterURL, "path": FilterPath, "host": FilterHost}
+	filterTargetStr = []string{"url", "path", "host"}
+)
+
+func (f *FilterTarget) Set(value string) error {
+	target, ok := filterTargetMap[strings.ToLower(value)]
+	if ok {
+		*f = target
+		return nil
+	}
+	return fmt.Errorf("unknown filter target: '%s'", value)
+}
+
+func (f *FilterTarget) String() string {
+	return filterTargetStr[*f]
+}
+
+// Filter url filter rule (glob or regular expression over url, path or host)
+type Filter struct {
+	Target FilterTarget
+	Glob   string // glob pattern (* match any chars, including /)
+	Regex  string // regular expression (unanchored)
+}
+
+type filterRule struct {
+	target FilterTarget
+	re     *regexp.Regexp
+}
+
+// urlFilter compiled accept/reject rules
+type urlFilter struct {
+	accept []filterRule
+	reject []filterRule
+}
+
+// globRegexp convert glob pattern to anchored regular expression
+func globRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteRune('^')
+	inClass := false
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		if inClass {
+			if c == ']' {
+				inClass = false
+			} else if c == '\\' {
+				sb.WriteByte('\\')
+			}
+			sb.WriteByte(c)
+			continue
+		}
+		switch c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteRune('.')
+		case '[':
+			if strings.IndexByte(glob[i+1:], ']') == -1 {
+				sb.WriteString("\\[")
+			} else {
+				inClass = true
+				sb.WriteByte(c)
+				if i+1 < len(glob) && glob[i+1] == '!' {
+					sb.WriteByte('^')
+					i++
+				}
+			}
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			} else {
+				sb.WriteString("\\\\")
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	sb.WriteRune('$')
+	return sb.String()
+}
+
+func compileFilters(filters []Filter) ([]filterRule, error) {
+	rules := make([]filterRule, 0, len(filters))
+	for i := range filters {
+		var expr string
+		if len(filters[i].Regex) > 0 {
+			if len(filters[i].Glob) > 0 {
+				return nil, fmt.Errorf("filter must have glob or regex, not both")
+			}
+			expr = filters[i].Regex
+		} else if len(filters[i].Glob) > 0 {
+			expr = globRegexp(filters[i].Glob)
+		} else {
+			return nil, fmt.Errorf("filter must have glob or regex")
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, filterRule{target: filters[i].Target, re: re})
+	}
+	return rules, nil
+}
+
+// SetURLFilters set accept/reject filters for links, found from root url (call after SetCanonicalizer)
+func (d *Downloader) SetURLFilters(url string, accept []Filter, reject []Filter) error {
+	var (
+		f   urlFilter
+		err error
+	)
+	if f.accept, err = compileFilters(accept); err != nil {
+		return fmt.Errorf("accept filter for %s: %s", url, err.Error())
+	}
+	if f.reject, err = compileFilters(reject); err != nil {
+		return fmt.Errorf("reject filter for %s: %s", url, err.Error())
+	}
+	if len(f.accept) == 0 && len(f.reject) == 0 {
+		delete(d.filters, d.canonicalizer.Canonical(url))
+	} else {
+		d.filters[d.canonicalizer.Canonical(url)] = &f
+	}
+	return nil
+}
+
+func matchRules(rules []filterRule, rawURL string, u *url.URL) bool {
+	for _, r := range rules {
+		var s string
+		switch r.target {
+		case FilterPath:
+			s = u.EscapedPath()
+		case FilterHost:
+			s = u.Hostname()
+		default:
+			s = rawURL
+		}
+		if r.re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlAccepted check url with filters of root url (rejected, if match any reject rule or not match any accept rule)
+func (d *Downloader) urlAccepted(rawURL string, root string) bool {
+	f, ok := d.filters[root]
+	if !ok {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if matchRules(f.reject, rawURL, u) {
+		return false
+	}
+	return len(f.accept) == 0 || matchRules(f.accept, rawURL, u)
+}
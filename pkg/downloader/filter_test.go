@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_globRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		s     string
+		match bool
+	}{
+		{"*.iso", "/pub/dist/image.iso", true},
+		{"*.iso", "/pub/dist/image.iso.html", false},
+		{"/logout*", "/logout", true},
+		{"/logout*", "/user/logout", false},
+		{"*.cdn.int", "static.cdn.int", true},
+		{"*.cdn.int", "cdn.int", false},
+		{"/img/?.png", "/img/1.png", true},
+		{"/img/[!0-9].png", "/img/1.png", false},
+		{"/img/[!0-9].png", "/img/a.png", true},
+		{"a+b(c)", "a+b(c)", true},
+		{"[x", "[x", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.s, func(t *testing.T) {
+			rules, err := compileFilters([]Filter{{Glob: tt.glob}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rules[0].re.MatchString(tt.s); got != tt.match {
+				t.Errorf("globRegexp(%s) = %s, match = %v, want %v", tt.glob, globRegexp(tt.glob), got, tt.match)
+			}
+		})
+	}
+}
+
+func TestDownloader_urlAccepted(t *testing.T) {
+	root := "http://test.int/"
+	d := NewDownloader(FlatMode, 1, time.Second, 1).SetIgnoreRobots(true)
+	d.AddRootURL(root, 2, 0, 1)
+	err := d.SetURLFilters(root,
+		[]Filter{
+			{Target: FilterHost, Glob: "test.int"},
+			{Target: FilterHost, Regex: `^(www|static)\.cdn\.int$`},
+		},
+		[]Filter{
+			{Target: FilterPath, Glob: "/logout*"},
+			{Target: FilterPath, Glob: "*.iso"},
+			{Target: FilterURL, Regex: `[?&]sort=`},
+			{Target: FilterPath, Regex: `^/calendar/`},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		root string
+		want bool
+	}{
+		{"http://test.int/index.html", root, true},
+		{"http://test.int/logout", root, false},
+		{"http://test.int/logout?next=/", root, false},
+		{"http://test.int/pub/image.iso", root, false},
+		{"http://test.int/list?page=2&sort=name", root, false},
+		{"http://test.int/list?page=2", root, true},
+		{"http://test.int/calendar/2020/08", root, false},
+		{"http://static.cdn.int/1.js", root, true},
+		{"http://other.cdn.int/1.js", root, false},
+		{"http://other.int/1.js", root, false},
+		{"http://other.int/1.js", "http://other.int/", true}, // no filters for root
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := d.urlAccepted(tt.url, tt.root); got != tt.want {
+				t.Errorf("Downloader.urlAccepted() = %v, want %v", got, tt.want)
+			}
+			if tt.root == root {
+				if got := d.addURL(tt.url, true, 1, "http://test.int", "/", tt.root, linkSource{}, 2, 0, 1); got != tt.want {
+					t.Errorf("Downloader.addURL() = %v, want %v", got, tt.want)
+				}
+				if got := d.taskByURL(tt.url) != nil; got != tt.want {
+					t.Errorf("Downloader.addURL() task added = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloader_SetURLFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []Filter
+		wantErr bool
+	}{
+		{"valid", []Filter{{Glob: "*.iso"}, {Target: FilterHost, Regex: "^cdn"}}, false},
+		{"empty", []Filter{{Target: FilterPath}}, true},
+		{"both", []Filter{{Glob: "*.iso", Regex: "iso$"}}, true},
+		{"invalid regex", []Filter{{Regex: "(iso"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(FlatMode, 1, time.Second, 1)
+			if err := d.SetURLFilters("http://test.int/", nil, tt.filters); (err != nil) != tt.wantErr {
+				t.Errorf("Downloader.SetURLFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// linkSource page, element and attribute, where link found
+type linkSource struct {
+	referrer string // page url (blank for root url)
+	tag      string // element name (or style for inline stylesheet, css for stylesheet file)
+	attr     string // attribute name (blank for css)
+}
+
+func (task *task) setSource(src linkSource) {
+	task.referrer = src.referrer
+	task.tag = src.tag
+	task.attr = src.attr
+}
+
+// edge reference from page to url
+type edge struct {
+	linkSource
+	url   string
+	links int32 // remaining links level for url by this reference
+}
+
+func (e *edge) key() string {
+	return e.referrer + "\t" + e.url + "\t" + e.tag + "\t" + e.attr
+}
+
+// Edge map record (one line per reference):
+//
+//	e referrer url tag attr links
+const (
+	mapRecordEdge       = "e"
+	mapRecordEdgeFields = 6
+)
+
+// mapRecord return map record for edge
+func (e *edge) mapRecord() string {
+	return strings.Join([]string{
+		mapRecordEdge, e.referrer, e.url, e.tag, e.attr, strconv.FormatInt(int64(e.links), 10),
+	}, "\t") + "\n"
+}
+
+// parseEdgeRecord parse edge map record
+func parseEdgeRecord(line string) (*edge, error) {
+	s := strings.Split(line, "\t")
+	if len(s) != mapRecordEdgeFields || s[0] != mapRecordEdge {
+		return nil, fmt.Errorf("map edge record incomplete: %s", line)
+	}
+	links, err := strconv.ParseInt(s[5], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("map edge record links must be a number: %s", line)
+	}
+	return &edge{linkSource: linkSource{referrer: s[1], tag: s[3], attr: s[4]}, url: s[2], links: int32(links)}, nil
+}
+
+// addEdge record reference (seen by addURL) and store it in map
+func (d *Downloader) addEdge(src linkSource, url string, links int32) {
+	if len(src.referrer) == 0 {
+		return
+	}
+	e := &edge{linkSource: src, url: url, links: links}
+	if _, exist := d.edges.GetOrInsert(e.key(), e); !exist {
+		d.filesLock.Lock()
+		d._storeEdge(e)
+		d.filesLock.Unlock()
+	}
+}
+
+// internal method, need lock filesLock before
+func (d *Downloader) _storeEdge(e *edge) {
+	if d.fMap == nil {
+		return
+	}
+	if _, err := d.fMap.Write([]byte(e.mapRecord())); err != nil {
+		d.runError(fmt.Errorf("map write: %s", err.Error()))
+		d.Abort()
+	}
+}
+
+// GraphNode link graph node (processed or skipped url)
+type GraphNode struct {
+	URL         string     `json:"url"`
+	State       TaskStatus `json:"state"`
+	FileName    string     `json:"file_name,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	Links       int32      `json:"links"` // remaining levels
+	DownLevel   int32      `json:"down_level"`
+	ExtLinks    int32      `json:"ext_links"`
+}
+
+// GraphEdge link graph edge (reference from page to url)
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Tag   string `json:"tag"`            // element name (or style, css)
+	Attr  string `json:"attr,omitempty"` // attribute name
+	Links int32  `json:"links"`          // remaining links level for url by this reference (page links skipped, if below 1)
+}
+
+// Graph link graph
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Graph build link graph (nodes sorted by url, edges by from and to), not safe for use with running downloader.
+// Edges are references, seen in this and previous runs (stored in map).
+func (d *Downloader) Graph() *Graph {
+	g := &Graph{Nodes: make([]GraphNode, 0, d.processed.Len()+d.skipped.Len()), Edges: make([]GraphEdge, 0, d.edges.Len())}
+	addNode := func(task *task) {
+		g.Nodes = append(g.Nodes, GraphNode{
+			URL: task.url, State: task.status, FileName: task.fileName, ContentType: task.contentType,
+			Links: task.Links(), DownLevel: task.DownLevel(), ExtLinks: task.ExtLinks(),
+		})
+	}
+	for kv := range d.processed.Iter() {
+		addNode(kv.Value.(*task))
+	}
+	for kv := range d.skipped.Iter() {
+		if _, ok := d.processed.Get(kv.Key); !ok {
+			addNode(kv.Value.(*task))
+		}
+	}
+	// node url for reference (equal urls by canonicalization rules)
+	nodeURL := func(url string) string {
+		if t := d.taskByURL(url); t != nil {
+			return t.url
+		}
+		if t, ok := d.skipped.Get(d.canonicalizer.Key(url)); ok {
+			return t.(*task).url
+		}
+		return url
+	}
+	for kv := range d.edges.Iter() {
+		e := kv.Value.(*edge)
+		g.Edges = append(g.Edges, GraphEdge{From: nodeURL(e.referrer), To: nodeURL(e.url), Tag: e.tag, Attr: e.attr, Links: e.links})
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].URL < g.Nodes[j].URL })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := &g.Edges[i], &g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		return a.Attr < b.Attr
+	})
+	return g
+}
+
+// WriteJSON write link graph in JSON format
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// dotQuote quote string for DOT
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// dotStyle return DOT node attributes for state
+func dotStyle(state TaskStatus) string {
+	switch state {
+	case TaskOK:
+		return ""
+	case TaskNotFound, TaskFailed:
+		return `, color="red"`
+	case TaskSkipped, TaskSkippedLevel, TaskSkippedFilter:
+		return `, color="gray", fontcolor="gray"`
+	default:
+		return `, style="dashed"`
+	}
+}
+
+// WriteDOT write link graph in Graphviz DOT format
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	ids := make(map[string]int, len(g.Nodes))
+	bw.WriteString("digraph godownloader {\n")
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		ids[n.URL] = i
+		fmt.Fprintf(bw, "  n%d [label=%s%s];\n", i, dotQuote(n.URL+"\n"+n.State.String()), dotStyle(n.State))
+	}
+	for i := range g.Edges {
+		e := &g.Edges[i]
+		from, ok := ids[e.From]
+		if !ok {
+			continue
+		}
+		to, ok := ids[e.To]
+		if !ok {
+			continue
+		}
+		label := e.Tag
+		if len(e.Attr) > 0 {
+			label += " " + e.Attr
+		}
+		fmt.Fprintf(bw, "  n%d -> n%d [label=%s];\n", from, to, dotQuote(label))
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
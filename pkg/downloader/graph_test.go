@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloader_Graph(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := tmpdir + "/" + "out"
+
+	d := NewDownloader(FlatMode, 1, time.Second, 2)
+	d.AddRootURL(baseAddr+"/index.html", 2, 0, 0)
+	if _, err = d.NewLoad(dir, "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	d.Start(1)
+	d.Wait()
+
+	g := d.Graph()
+
+	wantNodes := map[string]TaskStatus{
+		"/index.html":     TaskOK,
+		"/style.css":      TaskOK,
+		"/1.gif":          TaskOK,
+		"/1.gz":           TaskOK,
+		"/link1.html":     TaskOK,
+		"/link2.html":     TaskSkippedLevel,
+		"/not_found.html": TaskNotFound,
+	}
+	if len(g.Nodes) != len(wantNodes) {
+		t.Errorf("graph nodes = %d, want %d", len(g.Nodes), len(wantNodes))
+	}
+	for _, n := range g.Nodes {
+		if state, ok := wantNodes[n.URL[len(baseAddr):]]; !ok {
+			t.Errorf("graph node %s unexpected", n.URL)
+		} else if n.State != state {
+			t.Errorf("graph node %s state = %s, want %s", n.URL, n.State, state)
+		}
+	}
+
+	// index.html and link1.html has same links (but link1.html links to index.html and link2.html)
+	wantEdges := []GraphEdge{
+		{From: "/index.html", To: "/1.gif", Tag: "img", Attr: "src", Links: 1},
+		{From: "/index.html", To: "/1.gz", Tag: "a", Attr: "href", Links: 1},
+		{From: "/index.html", To: "/link1.html", Tag: "a", Attr: "href", Links: 1},
+		{From: "/index.html", To: "/not_found.html", Tag: "a", Attr: "href", Links: 1},
+		{From: "/index.html", To: "/style.css", Tag: "link", Attr: "href", Links: 1},
+		{From: "/link1.html", To: "/1.gif", Tag: "img", Attr: "src", Links: 0},
+		{From: "/link1.html", To: "/1.gz", Tag: "a", Attr: "href", Links: 0},
+		{From: "/link1.html", To: "/index.html", Tag: "a", Attr: "href", Links: 0},
+		{From: "/link1.html", To: "/link2.html", Tag: "a", Attr: "href", Links: 0},
+		{From: "/link1.html", To: "/not_found.html", Tag: "a", Attr: "href", Links: 0},
+		{From: "/link1.html", To: "/style.css", Tag: "link", Attr: "href", Links: 0},
+	}
+	for i := range wantEdges {
+		wantEdges[i].From = baseAddr + wantEdges[i].From
+		wantEdges[i].To = baseAddr + wantEdges[i].To
+	}
+	if !reflect.DeepEqual(g.Edges, wantEdges) {
+		t.Errorf("graph edges = %+v, want %+v", g.Edges, wantEdges)
+	}
+
+	var buf bytes.Buffer
+	if err = g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var jg Graph
+	if err = json.Unmarshal(buf.Bytes(), &jg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&jg, g) {
+		t.Errorf("graph json = %+v, want %+v", jg, g)
+	}
+
+	buf.Reset()
+	if err = g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, want := range []string{
+		"digraph godownloader {\n",
+		"  n2 [label=\"" + baseAddr + "/index.html\\nok\"];\n",
+		"  n5 [label=\"" + baseAddr + "/not_found.html\\nnot_found\", color=\"red\"];\n",
+		"  n2 -> n3 [label=\"a href\"];\n",
+		"  n3 -> n4 [label=\"a href\"];\n",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("graph dot not contain %q\n%s", want, dot)
+		}
+	}
+
+	// regenerate from map
+	dr := NewDownloader(FlatMode, 1, time.Second, 2)
+	dr.AddRootURL(baseAddr+"/index.html", 2, 0, 0)
+	if _, err = dr.ReportLoad(dir, "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	if got := dr.Graph(); !reflect.DeepEqual(got, g) {
+		t.Errorf("regenerated graph = %+v, want %+v", got, g)
+	}
+}
@@ -0,0 +1,147 @@
+package downloader
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/msaf1980/godownloader/pkg/urlutils"
+)
+
+// HostLimits per host politeness limits
+type HostLimits struct {
+	Rate     float64 // requests per second (0 for unlimited)
+	Burst    int     // max burst requests for rate limit (1 if not set)
+	MaxConns int     // max concurrent requests (0 for unlimited)
+}
+
+// hostLimiter token-bucket rate limiter and concurrency cap for host
+type hostLimiter struct {
+	bytes int64 // atomic downloaded bytes (for quota), first for 64-bit alignment
+
+	lock   sync.Mutex
+	limits HostLimits
+	tokens float64
+	last   time.Time // last tokens refill
+	active int
+
+	deferred []*task // tasks, deferred while host saturated
+	timer    bool    // wakeup timer for deferred tasks scheduled
+}
+
+func newHostLimiter(limits HostLimits) *hostLimiter {
+	if limits.Burst < 1 {
+		limits.Burst = 1
+	}
+	return &hostLimiter{limits: limits, tokens: float64(limits.Burst), last: time.Now()}
+}
+
+// refill internal method, need lock before
+func (h *hostLimiter) _refill(now time.Time) {
+	h.tokens += now.Sub(h.last).Seconds() * h.limits.Rate
+	if h.tokens > float64(h.limits.Burst) {
+		h.tokens = float64(h.limits.Burst)
+	}
+	h.last = now
+}
+
+func urlHost(url string) string {
+	_, host, _ := urlutils.SplitURLScheme(url)
+	return host
+}
+
+// SetHostLimits set default per host limits
+func (d *Downloader) SetHostLimits(limits HostLimits) *Downloader {
+	d.hostLimits = limits
+	return d
+}
+
+// SetURLHostLimits set limits for url host (override default limits)
+func (d *Downloader) SetURLHostLimits(url string, limits HostLimits) {
+	d.urlHostLimits[urlHost(url)] = limits
+}
+
+func (d *Downloader) hostLimiter(host string) *hostLimiter {
+	if v, ok := d.hosts.Get(host); ok {
+		return v.(*hostLimiter)
+	}
+	limits, ok := d.urlHostLimits[host]
+	if !ok {
+		limits = d.hostLimits
+	}
+	v, _ := d.hosts.GetOrInsert(host, newHostLimiter(limits))
+	return v.(*hostLimiter)
+}
+
+// hostAcquire get slot for task run, if host saturated, task deferred and false returned
+func (d *Downloader) hostAcquire(task *task) bool {
+	if task.protocol != HTTP {
+		return true
+	}
+	h := d.hostLimiter(urlHost(task.url))
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.limits.MaxConns > 0 && h.active >= h.limits.MaxConns {
+		d._deferTask(h, task)
+		return false
+	}
+	if h.limits.Rate > 0 {
+		now := time.Now()
+		h._refill(now)
+		if h.tokens < 1 {
+			d._deferTask(h, task)
+			if !h.timer {
+				h.timer = true
+				wait := time.Duration((1 - h.tokens) / h.limits.Rate * float64(time.Second))
+				time.AfterFunc(wait, func() { d.hostWakeup(h) })
+			}
+			return false
+		}
+		h.tokens--
+	}
+	h.active++
+	return true
+}
+
+// hostRelease release slot, acquired by hostAcquire
+func (d *Downloader) hostRelease(task *task) {
+	if task.protocol != HTTP {
+		return
+	}
+	h := d.hostLimiter(urlHost(task.url))
+	h.lock.Lock()
+	h.active--
+	d._requeueDeferred(h)
+	h.lock.Unlock()
+}
+
+// hostWakeup requeue deferred task after rate limit wait
+func (d *Downloader) hostWakeup(h *hostLimiter) {
+	h.lock.Lock()
+	h.timer = false
+	d._requeueDeferred(h)
+	if len(h.deferred) > 0 && h.limits.Rate > 0 {
+		h.timer = true
+		time.AfterFunc(time.Duration(float64(time.Second)/h.limits.Rate), func() { d.hostWakeup(h) })
+	}
+	h.lock.Unlock()
+}
+
+// internal method, need lock hostLimiter before
+func (d *Downloader) _deferTask(h *hostLimiter, task *task) {
+	d.queue.Defer(task)
+	atomic.AddInt32(&d.deferred, 1)
+	h.deferred = append(h.deferred, task)
+}
+
+// internal method, need lock hostLimiter before
+func (d *Downloader) _requeueDeferred(h *hostLimiter) {
+	if len(h.deferred) == 0 {
+		return
+	}
+	task := h.deferred[0]
+	h.deferred[0] = nil
+	h.deferred = h.deferred[1:]
+	d.queue.Put(task)
+	atomic.AddInt32(&d.deferred, -1)
+}
@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloader_hostLimitsConns(t *testing.T) {
+	d := NewDownloader(FlatMode, 1, time.Second, 1).SetHostLimits(HostLimits{MaxConns: 1})
+	d.SetURLHostLimits("http://test2.int/", HostLimits{MaxConns: 2})
+
+	t1 := newLoadTask("http://test.int/1.html", "/", 1, 0, 0, 1)
+	t2 := newLoadTask("http://test.int/2.html", "/", 1, 0, 0, 1)
+	if !d.hostAcquire(t1) {
+		t.Fatal("Downloader.hostAcquire() = false, want true")
+	}
+	if d.hostAcquire(t2) {
+		t.Fatal("Downloader.hostAcquire() = true for saturated host, want false")
+	}
+	if n := atomic.LoadInt32(&d.deferred); n != 1 {
+		t.Fatalf("Downloader deferred = %d, want 1", n)
+	}
+	if _, ok := d.queue.TryGet(); ok {
+		t.Fatal("Downloader.queue not emphy, deferred task busy-requeued")
+	}
+
+	// other hosts not limited
+	if !d.hostAcquire(newLoadTask("http://test2.int/1.html", "/", 1, 0, 0, 1)) {
+		t.Fatal("Downloader.hostAcquire() = false for other host, want true")
+	}
+	if !d.hostAcquire(newLoadTask("http://test2.int/2.html", "/", 1, 0, 0, 1)) {
+		t.Fatal("Downloader.hostAcquire() = false for other host with override limits, want true")
+	}
+
+	d.hostRelease(t1)
+	if n := atomic.LoadInt32(&d.deferred); n != 0 {
+		t.Fatalf("Downloader deferred = %d, want 0", n)
+	}
+	v, ok := d.queue.TryGet()
+	if !ok || v != t2 {
+		t.Fatal("Downloader.hostRelease() deferred task not requeued")
+	}
+	if !d.hostAcquire(t2) {
+		t.Fatal("Downloader.hostAcquire() = false after release, want true")
+	}
+}
+
+func TestDownloader_hostLimitsRate(t *testing.T) {
+	d := NewDownloader(FlatMode, 1, time.Second, 1).SetHostLimits(HostLimits{Rate: 10, Burst: 2})
+
+	tasks := []*task{
+		newLoadTask("http://test.int/1.html", "/", 1, 0, 0, 1),
+		newLoadTask("http://test.int/2.html", "/", 1, 0, 0, 1),
+		newLoadTask("http://test.int/3.html", "/", 1, 0, 0, 1),
+	}
+	start := time.Now()
+	for i, task := range tasks[0:2] {
+		if !d.hostAcquire(task) {
+			t.Fatalf("Downloader.hostAcquire() #%d = false in burst, want true", i)
+		}
+		d.hostRelease(task)
+	}
+	if d.hostAcquire(tasks[2]) {
+		t.Fatal("Downloader.hostAcquire() = true after burst, want false")
+	}
+	for atomic.LoadInt32(&d.deferred) > 0 {
+		if time.Since(start) > time.Second {
+			t.Fatal("Downloader deferred task not requeued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Downloader deferred task requeued after %v, want ~100ms", elapsed)
+	}
+	v, ok := d.queue.TryGet()
+	if !ok || v != tasks[2] {
+		t.Fatal("Downloader deferred task not requeued")
+	}
+	if !d.hostAcquire(tasks[2]) {
+		t.Fatal("Downloader.hostAcquire() = false after wait, want true")
+	}
+}
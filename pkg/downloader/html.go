@@ -4,13 +4,33 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/calbucci/go-htmlparser"
 	"github.com/msaf1980/godownloader/pkg/htmlutils"
 	"github.com/msaf1980/godownloader/pkg/urlutils"
 )
 
+// isLinkRef check for loadable reference (not blank, not anchor and not inline data)
+func isLinkRef(ref string) bool {
+	return len(ref) > 0 && ref[0] != '#' && !strings.HasPrefix(ref, "data:")
+}
+
+// isSingleTag check for tag without closing tag (source is void in HTML5, unknown tags, like picture, are paired)
+func isSingleTag(e *htmlparser.HtmlElement) bool {
+	if e.TagName == "source" {
+		return true
+	}
+	return e.ElementInfo != nil && e.ElementInfo.TagFormatting == htmlparser.HTFSingle
+}
+
+// htmlParse queue links from html and save it (not loaded links rewritten to absolute urls)
 func (d *Downloader) htmlParse(data []byte, task *task, firstParse bool) error {
+	return d.htmlRewrite(data, task, firstParse, d.loadRef(task))
+}
+
+// htmlRewrite rewrite references in html with rewrite result and save it (if changed or on first parse)
+func (d *Downloader) htmlRewrite(data []byte, task *task, firstParse bool, rewrite refRewriter) error {
 	changed := false
 
 	// r, _, err := htmlutils.DecodeHTMLReader(data, "")
@@ -69,10 +89,76 @@ func (d *Downloader) htmlParse(data []byte, task *task, firstParse bool) error {
 	// 	}
 	// }
 
-	baseHost, _ := urlutils.SplitURL(task.url)
-	baseLevel := task.Links()
-	baseDownLevel := task.DownLevel()
-	baseExtLevel := task.ExtLinks()
+	// base url for relative links (document url or from <base href>)
+	baseURL := task.url
+
+	// linkAttr extract link from attribute (absolute url saved in absAttr) and rewrite it
+	linkAttr := func(e *htmlparser.HtmlElement, attr string, absAttr string, needLoad bool, pageContent bool) {
+		ref, ok := e.GetAttributeValue(attr)
+		if !ok || !isLinkRef(ref) {
+			return
+		}
+		var absURL string
+		if firstParse {
+			absURL = urlutils.AbsURL(ref, baseURL)
+			e.SetAttribute(absAttr, absURL)
+		} else {
+			absURL, ok = e.GetAttributeValue(absAttr)
+			if !ok {
+				absURL = urlutils.AbsURL(ref, baseURL)
+			}
+		}
+		if newRef, ok := rewrite(absURL, ref, linkSource{tag: e.TagName, attr: attr}, needLoad, pageContent); ok && newRef != ref {
+			e.SetAttribute(attr, newRef)
+			changed = true
+		}
+	}
+
+	// srcsetAttr extract image candidates from srcset attribute (absolute urls saved in tppabs-srcset) and rewrite them
+	srcsetAttr := func(e *htmlparser.HtmlElement) {
+		srcset, ok := e.GetAttributeValue("srcset")
+		if !ok {
+			return
+		}
+		candidates := htmlutils.ParseSrcset(srcset)
+		if len(candidates) == 0 {
+			return
+		}
+		var absCandidates []htmlutils.SrcsetCandidate
+		if !firstParse {
+			if absSrcset, ok := e.GetAttributeValue("tppabs-srcset"); ok {
+				absCandidates = htmlutils.ParseSrcset(absSrcset)
+			}
+		}
+		if len(absCandidates) != len(candidates) {
+			absCandidates = make([]htmlutils.SrcsetCandidate, len(candidates))
+			refs := false
+			for i := range candidates {
+				absCandidates[i] = candidates[i]
+				if isLinkRef(candidates[i].URL) {
+					absCandidates[i].URL = urlutils.AbsURL(candidates[i].URL, baseURL)
+					refs = true
+				}
+			}
+			if refs {
+				e.SetAttribute("tppabs-srcset", htmlutils.FormatSrcset(absCandidates))
+			}
+		}
+		rewriteSrcset := false
+		for i := range candidates {
+			if !isLinkRef(candidates[i].URL) {
+				continue
+			}
+			if newRef, ok := rewrite(absCandidates[i].URL, candidates[i].URL, linkSource{tag: e.TagName, attr: "srcset"}, true, true); ok && newRef != candidates[i].URL {
+				candidates[i].URL = newRef
+				rewriteSrcset = true
+			}
+		}
+		if rewriteSrcset {
+			e.SetAttribute("srcset", htmlutils.FormatSrcset(candidates))
+			changed = true
+		}
+	}
 
 	var newHTML bytes.Buffer
 	r, _, err := htmlutils.DecodeHTMLBytes(data, "")
@@ -86,9 +172,24 @@ func (d *Downloader) htmlParse(data []byte, task *task, firstParse bool) error {
 	ended := false
 	parser.Parse(
 		func(text string, parent *htmlparser.HtmlElement) {
+			if parent != nil && parent.TagName == "style" {
+				if css, ok := d.cssParse(text, baseURL, task, linkSource{tag: "style"}, rewrite); ok {
+					text = css
+					changed = true
+				}
+			}
 			newHTML.WriteString(text)
 		},
 		func(e *htmlparser.HtmlElement, isEmpty bool) {
+			if e.HasAttribute("style") {
+				// style attribute is normalized (lowercased and broken on quotes) by parser, so always restore original
+				style, _ := htmlutils.RawAttribute(e.OriginalOpenTag, "style")
+				if css, ok := d.cssParse(style, baseURL, task, linkSource{tag: e.TagName, attr: "style"}, rewrite); ok {
+					style = css
+					changed = true
+				}
+				e.SetAttribute("style", style)
+			}
 			switch e.TagName {
 			case "meta":
 				charset, ok := e.GetAttributeValue("charset")
@@ -107,80 +208,65 @@ func (d *Downloader) htmlParse(data []byte, task *task, firstParse bool) error {
 						}
 					}
 				}
-			case "link":
+			case "base":
 				href, ok := e.GetAttributeValue("href")
-				if ok {
-					if len(href) > 0 && href[0] != '#' {
-						//typ, _ := e.GetAttributeValue("type")
-						rel, _ := e.GetAttributeValue("rel")
-						needLoad := false
-						// if typ == "application/rss+xml" || rel == "alternate" || rel == "search" || rel == "canonical" || rel="amphtml" {
-						// 	needLoad = false
-						// }
-						if rel == "stylesheet" || rel == "preload" || rel == "image_src" ||
-							rel == "shortcut icon" || rel == "apple-touch-icon" || rel == "icon" {
-							needLoad = true
-						}
-						var absURL string
-						if firstParse {
-							absURL = urlutils.AbsURL(href, baseHost)
-							e.SetAttribute("tppabs", absURL)
-						} else {
-							absURL, ok = e.GetAttributeValue("tppabs")
-							if !ok {
-								absURL = urlutils.AbsURL(href, baseHost)
-							}
-						}
-						if !needLoad || !d.addURL(absURL, true, d.retry, baseHost, task.rootDir, baseLevel, baseDownLevel, baseExtLevel) {
-							e.SetAttribute("href", absURL)
+				if ok && len(href) > 0 {
+					var absURL string
+					if firstParse {
+						absURL = urlutils.AbsURL(href, task.url)
+						e.SetAttribute("tppabs", absURL)
+					} else {
+						absURL, ok = e.GetAttributeValue("tppabs")
+						if !ok {
+							absURL = urlutils.AbsURL(href, task.url)
 						}
 					}
-					//fmt.Printf("link href='%s' type='%s' rel='%s'\n", absURL, typ, rel)
-				}
-			case "a":
-				href, ok := e.GetAttributeValue("href")
-				if ok {
-					if len(href) > 0 && href[0] != '#' {
-						var absURL string
-						if firstParse {
-							absURL = urlutils.AbsURL(href, baseHost)
-							e.SetAttribute("tppabs", absURL)
-						} else {
-							absURL, ok = e.GetAttributeValue("tppabs")
-							if !ok {
-								absURL = urlutils.AbsURL(href, baseHost)
-							}
-						}
-						if !d.addURL(absURL, false, d.retry, baseHost, task.rootDir, baseLevel, baseDownLevel, baseExtLevel) {
-							e.SetAttribute("href", absURL)
-						}
+					baseURL = absURL
+					// blank reference (links converted to local paths), base removed
+					if newRef, ok := rewrite(absURL, href, linkSource{tag: "base", attr: "href"}, false, false); ok && len(newRef) == 0 {
+						e.RemoveAttribute("href")
+						changed = true
 					}
-					//fmt.Printf("a href='%s'\n", absURL)
+				} else if absURL, ok := e.GetAttributeValue("tppabs"); ok {
+					// already converted
+					baseURL = absURL
 				}
-			case "iframe", "img", "script":
-				pageContent := true
-				if e.TagName == "iframe" {
-					pageContent = false
+			case "link":
+				rel, _ := e.GetAttributeValue("rel")
+				needLoad := false
+				// if typ == "application/rss+xml" || rel == "alternate" || rel == "search" || rel == "canonical" || rel="amphtml" {
+				// 	needLoad = false
+				// }
+				if rel == "stylesheet" || rel == "preload" || rel == "image_src" ||
+					rel == "shortcut icon" || rel == "apple-touch-icon" || rel == "icon" {
+					needLoad = true
 				}
-				src, ok := e.GetAttributeValue("src")
-				if ok {
-					if len(src) > 0 && src[0] != '#' {
-						var absURL string
-						if firstParse {
-							absURL = urlutils.AbsURL(src, baseHost)
-							e.SetAttribute("tppabs", absURL)
-						} else {
-							absURL, ok = e.GetAttributeValue("tppabs")
-							if !ok {
-								absURL = urlutils.AbsURL(src, baseHost)
-							}
-						}
-						if !d.addURL(absURL, pageContent, d.retry, baseHost, task.rootDir, baseLevel, baseDownLevel, baseExtLevel) {
-							e.SetAttribute("src", absURL)
-						}
-					}
-					//fmt.Printf("%s src='%s'\n", e.TagName, absURL)
+				linkAttr(e, "href", "tppabs", needLoad, true)
+			case "a":
+				linkAttr(e, "href", "tppabs", true, false)
+			case "iframe":
+				linkAttr(e, "src", "tppabs", true, false)
+			case "img":
+				linkAttr(e, "src", "tppabs", true, true)
+				srcsetAttr(e)
+			case "script", "audio", "track", "embed":
+				linkAttr(e, "src", "tppabs", true, true)
+			case "video":
+				linkAttr(e, "src", "tppabs", true, true)
+				linkAttr(e, "poster", "tppabs-poster", true, true)
+			case "source":
+				// video/audio > source[src], picture > source[srcset]
+				linkAttr(e, "src", "tppabs", true, true)
+				srcsetAttr(e)
+			case "object":
+				linkAttr(e, "data", "tppabs", true, true)
+			case "input":
+				typ, _ := e.GetAttributeValue("type")
+				if strings.EqualFold(typ, "image") {
+					linkAttr(e, "src", "tppabs", true, true)
 				}
+			case "body":
+				linkAttr(e, "background", "tppabs-background", true, true)
 			}
 			if tags > 0 {
 				if e.TagName != "br" {
@@ -189,7 +275,7 @@ func (d *Downloader) htmlParse(data []byte, task *task, firstParse bool) error {
 				}
 			}
 			newHTML.WriteString(e.GetOpenTag(false, false))
-			if e.ElementInfo.TagFormatting == htmlparser.HTFSingle {
+			if isSingleTag(e) {
 				ended = true
 			} else {
 				ended = false
@@ -208,7 +294,7 @@ func (d *Downloader) htmlParse(data []byte, task *task, firstParse bool) error {
 	)
 	newHTML.WriteRune('\n')
 
-	if changed || firstParse {
+	if (changed || firstParse) && !d.check {
 		fileName := d.outdir + "/" + task.fileName
 		tmpfile := fileName + ".part"
 		err = ioutil.WriteFile(tmpfile, newHTML.Bytes(), 0644)
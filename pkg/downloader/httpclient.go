@@ -1,59 +1,182 @@
 package downloader
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
-
 	//"github.com/PuerkitoBio/goquery"
-
-	"github.com/franela/goreq"
 )
 
+var errNotModified = errors.New("Not modified")
+
+// mediaType return lowercased media type from Content-Type header (without parameters)
+func mediaType(contentType string) string {
+	if i := strings.Index(contentType, ";"); i > 0 {
+		contentType = contentType[0:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// partSize return size of partially downloaded file (if resume is possible)
+func (d *Downloader) partSize(task *task) int64 {
+	if len(task.fileName) == 0 || task.contentType == "text/html" || task.contentType == "text/css" {
+		return 0
+	}
+	if len(task.etag) == 0 && len(task.lastModified) == 0 {
+		// no validator for If-Range
+		return 0
+	}
+	stat, err := os.Stat(d.outdir + "/" + task.fileName + ".part")
+	if err != nil || stat.IsDir() {
+		return 0
+	}
+	return stat.Size()
+}
+
+// ifRange return validator for If-Range header (weak etag can't be used)
+func ifRange(task *task) string {
+	if len(task.etag) > 0 && !strings.HasPrefix(task.etag, "W/") {
+		return task.etag
+	}
+	return task.lastModified
+}
+
+// contentRangeStart return start offset from Content-Range header (bytes N-M/SIZE)
+func contentRangeStart(contentRange string) (int64, error) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, fmt.Errorf("invalid Content-Range '%s'", contentRange)
+	}
+	i := strings.Index(contentRange, "-")
+	if i == -1 {
+		return 0, fmt.Errorf("invalid Content-Range '%s'", contentRange)
+	}
+	return strconv.ParseInt(contentRange[6:i], 10, 64)
+}
+
+func (d *Downloader) httpRequest(task *task, offset int64) (*http.Response, error) {
+	if err := d.crawlDelay(task.url); err != nil {
+		return nil, err
+	}
+	req, err := d.newRequest(task.url)
+	if err != nil {
+		return nil, err
+	}
+	if task.status == TaskOK {
+		// conditional request for downloaded file
+		if len(task.etag) > 0 {
+			req.Header.Set("If-None-Match", task.etag)
+		}
+		if len(task.lastModified) > 0 {
+			req.Header.Set("If-Modified-Since", task.lastModified)
+		}
+	} else if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		if validator := ifRange(task); len(validator) > 0 {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+	return d.client.Do(req)
+}
+
 func (d *Downloader) httpLoad(task *task) error {
-	resp, err := goreq.Request{Uri: task.url, MaxRedirects: d.maxRedirects, Timeout: d.timeout}.Do()
+	if d.check {
+		return d.httpCheck(task)
+	}
+	if err := d.checkQuotas(task); err != nil {
+		return err
+	}
+	offset := d.partSize(task)
+	resp, err := d.httpRequest(task, offset)
+	if err == nil && offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// restart download
+		resp.Body.Close()
+		offset = 0
+		resp, err = d.httpRequest(task, offset)
+	}
 	if err == nil {
-		if resp.StatusCode == http.StatusNotFound {
-			err = fmt.Errorf("Not found")
+		task.httpStatus = resp.StatusCode
+		d.observer.TaskResponse(task.info(), resp.StatusCode, resp.Header)
+		if task.status == TaskOK && resp.StatusCode == http.StatusNotModified {
+			err = errNotModified
+		} else if resp.StatusCode == http.StatusNotFound {
+			err = ErrNotFound
 			task.try = 0
-		} else if resp.StatusCode == http.StatusOK {
-			if len(task.fileName) == 0 {
-				c := resp.Header.Get("Content-Type")
-				i := strings.Index(c, ";")
-				if i > 0 {
-					task.contentType = c[0:i]
+			task.status = TaskNotFound
+		} else if resp.StatusCode == http.StatusOK || (offset > 0 && resp.StatusCode == http.StatusPartialContent) {
+			if resp.StatusCode == http.StatusOK {
+				offset = 0
+				task.etag = resp.Header.Get("ETag")
+				task.lastModified = resp.Header.Get("Last-Modified")
+			} else {
+				var start int64
+				start, err = contentRangeStart(resp.Header.Get("Content-Range"))
+				if err == nil && start != offset {
+					err = fmt.Errorf("Content-Range start %d, want %d", start, offset)
 				}
+			}
+			if err == nil && len(task.fileName) == 0 {
+				task.contentType = mediaType(resp.Header.Get("Content-Type"))
+			}
+			if err == nil {
+				err = d.checkDownload(task, offset, resp.ContentLength)
+			}
+			if err == nil && task.status != TaskOK {
+				if err = d.acquireFile(); err == nil {
+					defer d.releaseFile(task)
+				}
+			}
+			if err == nil && len(task.fileName) == 0 {
 				d.filesLock.Lock()
 				err = d._genTaskFileName(task)
 				d.filesLock.Unlock()
 				//err = fmt.Errorf("download not realized at now")
 			}
 		} else {
-			err = fmt.Errorf("Failed with http status %d", resp.StatusCode)
+			err = &StatusError{StatusCode: resp.StatusCode}
 		}
-		// TODO: restart download
 		if err == nil {
 			task.size = resp.ContentLength
+			total := int64(-1)
+			if resp.ContentLength >= 0 {
+				total = offset + resp.ContentLength
+			}
+			body := d.newProgressReader(d.newQuotaReader(resp.Body, task, offset), task, offset, total)
 			if task.contentType == "text/html" {
-				err = d.htmlLoad(resp.Body, task)
+				err = d.htmlLoad(body, task)
+			} else if task.contentType == "text/css" {
+				err = d.cssLoad(body, task)
 			} else {
 				var f *os.File
 				fileName := d.outdir + "/" + task.fileName
 				tmpfile := fileName + ".part"
-				f, err = os.OpenFile(tmpfile, os.O_RDWR|os.O_CREATE, 0644)
+				if offset > 0 {
+					// resume download
+					if task.size >= 0 {
+						task.size += offset
+					}
+					f, err = os.OpenFile(tmpfile, os.O_WRONLY|os.O_APPEND, 0644)
+				} else {
+					f, err = os.OpenFile(tmpfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+				}
 				if err == nil {
-					_, err = io.Copy(f, resp.Body)
+					_, err = io.Copy(f, body)
 					if err == nil {
-						if task.size == 0 {
+						if task.size <= 0 {
 							stat, _ := f.Stat()
 							task.size = stat.Size()
 						}
 						err = f.Close()
 					} else {
 						f.Close()
+						if isQuotaError(err) {
+							// not resumable
+							os.Remove(tmpfile)
+						}
 					}
 					if err == nil {
 						err = os.Rename(tmpfile, fileName)
@@ -61,7 +184,7 @@ func (d *Downloader) httpLoad(task *task) error {
 				}
 			}
 			if err == nil {
-				task.success = true
+				task.status = TaskOK
 			}
 		}
 		resp.Body.Close()
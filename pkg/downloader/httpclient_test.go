@@ -1,6 +1,7 @@
 package downloader
 
 import (
+	"bytes"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -155,3 +156,225 @@ func TestDownloader_httpLoad(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloader_httpLoadResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	modTime := time.Date(2020, 8, 22, 6, 0, 0, 0, time.UTC)
+	etag := `"content-v1"`
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/robots.txt" {
+			http.NotFound(w, req)
+			return
+		}
+		ranges = append(ranges, req.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, req, "data.bin", modTime, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	dir := tmpdir + "/" + "out"
+	d := NewDownloader(FlatMode, 1, time.Second, 2)
+	d.AddRootURL(ts.URL+"/data.bin", 1, 0, 0)
+	_, err = d.NewLoad(dir, "godownloader.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.closeMap()
+
+	tests := []struct {
+		name      string
+		etag      string
+		part      []byte
+		wantRange string
+	}{
+		{"resume", etag, content[0:4000], "bytes=4000-"},
+		{"changed (full download)", `"content-v0"`, []byte(strings.Repeat("x", 4000)), "bytes=4000-"},
+		{"not satisfiable (full download)", etag, append(content, 'x'), "bytes=10001-,"},
+		{"no part (full download)", etag, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := newLoadTask(ts.URL+"/data.bin", "/", 1, 0, 0, 1)
+			task.fileName = "data.bin"
+			task.contentType = "application/octet-stream"
+			task.etag = tt.etag
+			fileName := d.outdir + "/" + task.fileName
+			os.Remove(fileName)
+			if tt.part != nil {
+				if err := ioutil.WriteFile(fileName+".part", tt.part, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ranges = nil
+
+			if err := d.httpLoad(task); err != nil {
+				t.Fatalf("Downloader.httpLoad() error = '%v'", err)
+			}
+			if strings.Join(ranges, ",") != tt.wantRange {
+				t.Errorf("Downloader.httpLoad() Range = %v, want '%s'", ranges, tt.wantRange)
+			}
+			if task.size != int64(len(content)) {
+				t.Errorf("Downloader.httpLoad() size = %d, want %d", task.size, len(content))
+			}
+			if task.etag != etag {
+				t.Errorf("Downloader.httpLoad() etag = %s, want %s", task.etag, etag)
+			}
+			result, err := ioutil.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, content) {
+				t.Errorf("Downloader.httpLoad() result file mismatched")
+			}
+		})
+	}
+}
+
+func TestDownloader_cookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/login.html":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/", MaxAge: 3600})
+			w.Write([]byte("login"))
+		case "/private.bin":
+			if c, err := req.Cookie("session"); err != nil || c.Value != "s1" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("private"))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := tmpdir + "/" + "out"
+
+	d := NewDownloader(FlatMode, 1, time.Second, 1)
+	d.AddRootURL(ts.URL+"/login.html", 1, 0, 0)
+	if _, err = d.NewLoad(dir, "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.httpLoad(newLoadTask(ts.URL+"/private.bin", "/", 1, 0, 0, 1)); err == nil {
+		t.Fatal("Downloader.httpLoad() without session cookie must fail")
+	}
+	if err = d.httpLoad(newLoadTask(ts.URL+"/login.html", "/", 1, 0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.httpLoad(newLoadTask(ts.URL+"/private.bin", "/", 1, 0, 0, 1)); err != nil {
+		t.Fatalf("Downloader.httpLoad() with session cookie error = '%v'", err)
+	}
+	d.Wait()
+
+	// continue with saved session
+	dc := NewDownloader(FlatMode, 1, time.Second, 1)
+	dc.AddRootURL(ts.URL+"/login.html", 1, 0, 0)
+	if _, err = dc.ExistingLoad(dir, "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	defer dc.closeMap()
+	task := newLoadTask(ts.URL+"/private.bin", "/", 1, 0, 0, 1)
+	task.fileName = "private-1.bin"
+	if err = dc.httpLoad(task); err != nil {
+		t.Fatalf("Downloader.httpLoad() with restored session cookie error = '%v'", err)
+	}
+}
+
+func TestDownloader_httpLoadMedia(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	d := NewDownloader(FlatMode, 1, time.Second, 2)
+	d.AddRootURL("http://127.0.0.1/", 1, 0, 0)
+	_, err = d.NewLoad(tmpdir+"/out", "godownloader.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+	task := newLoadTask(baseAddr+"/media.html", "/", 1, 0, 0, 1)
+	if err = d.httpLoad(task); err != nil {
+		t.Fatalf("Downloader.httpLoad() error = '%v'", err)
+	}
+	verifyFile(t, d.outdir, task.fileName, "test/media.html.tpl", baseAddr)
+
+	links := map[string]bool{
+		"http://127.0.0.1/":  true, // root URL, not downloaded at this step
+		baseAddr + "/bg.gif": true, baseAddr + "/1.gif": true, baseAddr + "/img/1-2x.gif": true,
+		baseAddr + "/img/1.webp": true, baseAddr + "/img/1-large.webp": true,
+		baseAddr + "/video/1.mp4": true, baseAddr + "/video/1.jpg": true,
+		baseAddr + "/video/1.webm": true, baseAddr + "/video/1.vtt": true,
+		baseAddr + "/audio/1.ogg": true, baseAddr + "/1.swf": true, baseAddr + "/1.svg": true,
+		baseAddr + "/submit.gif": true,
+	}
+	for k := range d.processed.Iter() {
+		url := k.Key.(string)
+		if _, ok := links[url]; !ok {
+			t.Errorf("Downloader.httpLoad() link %s extracted, but not required", url)
+		}
+	}
+	for url := range links {
+		if _, ok := d.processed.Get(url); !ok {
+			t.Errorf("Downloader.httpLoad() link %s not extracted", url)
+		}
+	}
+}
+
+func TestDownloader_httpLoadBase(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	d := NewDownloader(DirMode, 1, time.Second, 2)
+	d.AddRootURL("http://127.0.0.1/", 1, 0, 0)
+	_, err = d.NewLoad(tmpdir+"/out", "godownloader.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+	task := newLoadTask(baseAddr+"/docs/x/base.html", "/", 2, 2, 0, 1)
+	if err = d.httpLoad(task); err != nil {
+		t.Fatalf("Downloader.httpLoad() error = '%v'", err)
+	}
+
+	links := map[string]bool{
+		"http://127.0.0.1/":     true, // root URL, not downloaded at this step
+		baseAddr + "/style.css": true, baseAddr + "/docs/img/h1.png": true, baseAddr + "/docs/img/a.png": true,
+		baseAddr + "/link1.html?q=1": true, baseAddr + "/docs/?page=2": true,
+	}
+	for k := range d.processed.Iter() {
+		url := k.Key.(string)
+		if _, ok := links[url]; !ok {
+			t.Errorf("Downloader.httpLoad() link %s extracted, but not required", url)
+		}
+	}
+	for url := range links {
+		if _, ok := d.processed.Get(url); !ok {
+			t.Errorf("Downloader.httpLoad() link %s not extracted", url)
+		}
+	}
+}
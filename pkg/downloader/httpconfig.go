@@ -0,0 +1,164 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ProxyFromEnv use proxy from environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY)
+const ProxyFromEnv = "env"
+
+// HTTPConfig http client settings
+type HTTPConfig struct {
+	MaxIdleConns        int           // max idle (keep-alive) connections (0 for unlimited)
+	MaxIdleConnsPerHost int           // max idle (keep-alive) connections per host (0 for http.DefaultMaxIdleConnsPerHost)
+	MaxConnsPerHost     int           // max connections per host (0 for unlimited)
+	IdleConnTimeout     time.Duration // idle (keep-alive) connection timeout (0 for unlimited)
+	DisableKeepAlives   bool
+	HTTP2               bool // try HTTP/2 for https
+
+	Proxy string // proxy url (http://, https:// or socks5://), ProxyFromEnv or blank for direct connections
+
+	CACert             string // custom CA bundle file (PEM)
+	InsecureSkipVerify bool
+	ClientCert         string // client certificate file (PEM)
+	ClientKey          string // client certificate key file (PEM)
+
+	Headers map[string]string // default request headers
+}
+
+// DefaultHTTPConfig return default http client settings
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		MaxIdleConns:    100,
+		IdleConnTimeout: 90 * time.Second,
+		HTTP2:           true,
+		Proxy:           ProxyFromEnv,
+	}
+}
+
+func tlsConfig(cfg *HTTPConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if len(cfg.CACert) > 0 {
+		pem, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACert)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if len(cfg.ClientCert) > 0 || len(cfg.ClientKey) > 0 {
+		if len(cfg.ClientCert) == 0 || len(cfg.ClientKey) == 0 {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+func newTransport(cfg *HTTPConfig) (*http.Transport, error) {
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsCfg,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+	}
+	if !cfg.HTTP2 {
+		// disable HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	switch cfg.Proxy {
+	case "":
+	case ProxyFromEnv:
+		transport.Proxy = http.ProxyFromEnvironment
+	default:
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy '%s': %s", cfg.Proxy, err.Error())
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme '%s'", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return transport, nil
+}
+
+// newHTTPClient build http client
+func (d *Downloader) newHTTPClient(cfg *HTTPConfig) (*http.Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: &authTransport{d: d, next: transport},
+		Jar:       d.jar,
+		Timeout:   d.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > d.maxRedirects {
+				// return redirect response
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}, nil
+}
+
+// SetHTTPConfig build http client with settings
+func (d *Downloader) SetHTTPConfig(cfg HTTPConfig) error {
+	client, err := d.newHTTPClient(&cfg)
+	if err != nil {
+		return err
+	}
+	headers := make(http.Header)
+	for k, v := range cfg.Headers {
+		headers.Set(k, v)
+	}
+	d.client = client
+	d.headers = headers
+	return nil
+}
+
+// newRequest create GET request with default headers
+func (d *Downloader) newRequest(url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range d.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+	return req, nil
+}
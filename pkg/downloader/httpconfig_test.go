@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDownloader_SetHTTPConfig(t *testing.T) {
+	var headers http.Header
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		headers = req.Header
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	caCert := tmpdir + "/ca.pem"
+	err = ioutil.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		cfg        HTTPConfig
+		wantErr    bool
+		wantReqErr bool
+	}{
+		{"untrusted certificate", HTTPConfig{}, false, true},
+		{"insecure", HTTPConfig{InsecureSkipVerify: true, Headers: map[string]string{"X-Test": "test"}}, false, false},
+		{"ca bundle", HTTPConfig{CACert: caCert, HTTP2: true, Proxy: ProxyFromEnv}, false, false},
+		{"ca bundle not found", HTTPConfig{CACert: tmpdir + "/not_found.pem"}, true, false},
+		{"client cert without key", HTTPConfig{ClientCert: caCert}, true, false},
+		{"socks5 proxy", HTTPConfig{Proxy: "socks5://127.0.0.1:1080"}, false, true},
+		{"unsupported proxy", HTTPConfig{Proxy: "ftp://127.0.0.1:21"}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(FlatMode, 1, time.Second, 1).SetUserAgent("godownloader-test")
+			err := d.SetHTTPConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Downloader.SetHTTPConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			headers = nil
+			req, err := d.newRequest(ts.URL + "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := d.client.Do(req)
+			if (err != nil) != tt.wantReqErr {
+				t.Fatalf("Downloader.client.Do() error = %v, wantErr %v", err, tt.wantReqErr)
+			}
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			if ua := headers.Get("User-Agent"); ua != "godownloader-test" {
+				t.Errorf("User-Agent = '%s', want '%s'", ua, "godownloader-test")
+			}
+			for k, v := range tt.cfg.Headers {
+				if got := headers.Get(k); got != v {
+					t.Errorf("header %s = '%s', want '%s'", k, got, v)
+				}
+			}
+		})
+	}
+}
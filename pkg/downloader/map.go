@@ -0,0 +1,339 @@
+package downloader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Map file format
+//
+// Legacy (v1) map store two lines per task:
+//
+//	url
+//	fileName contentType
+//
+// v2 map store one tab-separated line per task state change (last record for url win):
+//
+//	v2 url rootDir fileName contentType links downLevel extLinks status size try etag lastModified created updated root referrer httpStatus attempts duration tag attr
+//
+// root and later fields are optional (absent in early v2 records), duration stored in milliseconds.
+// Urls, skipped by level or filters, stored with skipped_level and skipped_filter status (for report).
+// References (link graph edges) stored in edge records (see mapRecordEdge).
+const (
+	mapRecordV2          = "v2"
+	mapRecordV2MinFields = 15
+	mapRecordV2Fields    = 22
+)
+
+// mapEscape strip separators from map field
+func mapEscape(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+func mapTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func parseMapTime(s string) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(n, 0), nil
+}
+
+// mapRecord return v2 map record for task
+func (task *task) mapRecord() string {
+	return strings.Join([]string{
+		mapRecordV2, task.url, task.rootDir, task.fileName, task.contentType,
+		strconv.FormatInt(int64(task.Links()), 10),
+		strconv.FormatInt(int64(task.DownLevel()), 10),
+		strconv.FormatInt(int64(task.ExtLinks()), 10),
+		task.status.String(),
+		strconv.FormatInt(task.size, 10),
+		strconv.Itoa(task.try),
+		mapEscape(task.etag), mapEscape(task.lastModified),
+		mapTime(task.created), mapTime(task.updated),
+		task.root, task.referrer,
+		strconv.Itoa(task.httpStatus),
+		strconv.Itoa(task.attempts),
+		strconv.FormatInt(int64(task.duration/time.Millisecond), 10),
+		task.tag, task.attr,
+	}, "\t") + "\n"
+}
+
+// parseMapRecord parse v2 map record
+func parseMapRecord(line string) (*task, error) {
+	s := strings.Split(line, "\t")
+	if len(s) < mapRecordV2MinFields || len(s) > mapRecordV2Fields || s[0] != mapRecordV2 {
+		return nil, fmt.Errorf("map record incomplete: %s", line)
+	}
+	var levels [3]int32
+	for i := range levels {
+		n, err := strconv.ParseInt(s[5+i], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("map record level must be a number: %s", line)
+		}
+		levels[i] = int32(n)
+	}
+	t := newLoadTask(s[1], s[2], levels[0], levels[1], levels[2], 0)
+	t.fileName = s[3]
+	t.contentType = s[4]
+	if err := t.status.Set(s[8]); err != nil {
+		return nil, err
+	}
+	var err error
+	if t.size, err = strconv.ParseInt(s[9], 10, 64); err != nil {
+		return nil, fmt.Errorf("map record size must be a number: %s", line)
+	}
+	if t.try, err = strconv.Atoi(s[10]); err != nil {
+		return nil, fmt.Errorf("map record try must be a number: %s", line)
+	}
+	t.etag = s[11]
+	t.lastModified = s[12]
+	if t.created, err = parseMapTime(s[13]); err != nil {
+		return nil, fmt.Errorf("map record created must be a timestamp: %s", line)
+	}
+	if t.updated, err = parseMapTime(s[14]); err != nil {
+		return nil, fmt.Errorf("map record updated must be a timestamp: %s", line)
+	}
+	if len(s) > 15 {
+		t.root = s[15]
+	}
+	if len(s) > 16 {
+		t.referrer = s[16]
+	}
+	if len(s) > 17 {
+		if t.httpStatus, err = strconv.Atoi(s[17]); err != nil {
+			return nil, fmt.Errorf("map record http status must be a number: %s", line)
+		}
+	}
+	if len(s) > 18 {
+		if t.attempts, err = strconv.Atoi(s[18]); err != nil {
+			return nil, fmt.Errorf("map record attempts must be a number: %s", line)
+		}
+	}
+	if len(s) > 19 {
+		ms, err := strconv.ParseInt(s[19], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("map record duration must be a number: %s", line)
+		}
+		t.duration = time.Duration(ms) * time.Millisecond
+	}
+	if len(s) > 20 {
+		t.tag = s[20]
+	}
+	if len(s) > 21 {
+		t.attr = s[21]
+	}
+	return t, nil
+}
+
+func (d *Downloader) newMap() (err error) {
+	if d.fMap != nil {
+		return fmt.Errorf("map already open")
+	}
+	d.fMap, err = os.OpenFile(d.fileMap, os.O_CREATE|os.O_RDWR, 0o644)
+	return
+}
+
+// loadMapTask merge task state, loaded from map
+func (d *Downloader) loadMapTask(t *task) {
+	if t.status == TaskSkippedLevel || t.status == TaskSkippedFilter {
+		d.skipped.Set(d.canonicalizer.Key(t.url), t)
+		return
+	}
+	task, exist := d.addTask(t)
+	if exist {
+		if len(t.rootDir) > 0 {
+			task.rootDir = t.rootDir
+		}
+		if len(t.root) > 0 {
+			task.root = t.root
+		}
+		if len(t.referrer) > 0 {
+			task.referrer = t.referrer
+			task.tag = t.tag
+			task.attr = t.attr
+		}
+		task.httpStatus = t.httpStatus
+		task.attempts = t.attempts
+		task.duration = t.duration
+		if task.fileName != t.fileName && len(task.fileName) > 0 && d.taskByFileName(task.fileName) == task {
+			// file renamed, stale name is free
+			d.files.Del(task.fileName)
+		}
+		task.fileName = t.fileName
+		task.contentType = t.contentType
+		task.status = t.status
+		task.size = t.size
+		task.try = t.try
+		task.etag = t.etag
+		task.lastModified = t.lastModified
+		if !t.created.IsZero() {
+			task.created = t.created
+		}
+		task.updated = t.updated
+		task.UpdateLinks(t.Links(), t.DownLevel(), t.ExtLinks())
+	}
+	if len(task.fileName) > 0 {
+		// reserve loaded file name, so new tasks not overwrite it
+		d.files.Set(task.fileName, task)
+	}
+}
+
+// readMap load tasks from map, return end of last complete line (incomplete is true, if last line not terminated)
+func (d *Downloader) readMap(f *os.File) (offset int64, incomplete bool, err error) {
+	reader := bufio.NewReader(f)
+	var t *task
+	for {
+		line, rerr := reader.ReadString('\n')
+		if rerr != nil {
+			if rerr != io.EOF {
+				err = rerr
+			} else if len(line) > 0 {
+				// write interrupted
+				d.logger.Warn().Str("map", f.Name()).Str("line", line).Msg("incomplete map record dropped")
+				incomplete = true
+			}
+			return
+		}
+		offset += int64(len(line))
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if t == nil {
+			if strings.HasPrefix(line, mapRecordEdge+"\t") {
+				var e *edge
+				if e, err = parseEdgeRecord(line); err != nil {
+					return
+				}
+				d.edges.Set(e.key(), e)
+			} else if strings.HasPrefix(line, mapRecordV2+"\t") {
+				t, err = parseMapRecord(line)
+				if err != nil {
+					return
+				}
+				d.loadMapTask(t)
+				t = nil
+			} else {
+				t = newLoadTask(line, "", 0, 0, 0, 0)
+			}
+		} else {
+			// legacy record
+			s := strings.Split(line, " ")
+			if len(s) != 2 {
+				err = fmt.Errorf("map fileName/contentType line incomplete: %s", line)
+				return
+			}
+			t.fileName = s[0]
+			t.contentType = s[1]
+			t.created = time.Time{}
+			d.loadMapTask(t)
+			t = nil
+		}
+	}
+}
+
+// loadMap load tasks from map without requeue (read-only)
+func (d *Downloader) loadMap(fileMap string) error {
+	f, err := os.Open(fileMap)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, _, err = d.readMap(f)
+	return err
+}
+
+func (d *Downloader) openMap() (err error) {
+	if d.fMap != nil {
+		return fmt.Errorf("map already open")
+	}
+	d.fMap, err = os.OpenFile(d.fileMap, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+
+	// already queued (root) tasks
+	queued := make(map[*task]bool)
+	for kv := range d.processed.Iter() {
+		queued[kv.Value.(*task)] = true
+	}
+
+	offset, incomplete, err := d.readMap(d.fMap)
+	if err != nil {
+		return
+	}
+	if incomplete {
+		// truncate incomplete last line before append new records
+		if err = d.fMap.Truncate(offset); err != nil {
+			return
+		}
+	}
+
+	// requeue unfinished tasks
+	for kv := range d.processed.Iter() {
+		task := kv.Value.(*task)
+		task.ResetRecheck()
+		if task.status == TaskFailed || task.status == TaskSkipped {
+			// new try for failed and skipped (quotas are per run) tasks
+			task.status = TaskNew
+			task.try = 0
+		}
+		if task.status == TaskNew {
+			if task.try < 1 {
+				task.try = d.retry
+			}
+			if !queued[task] {
+				d.queue.Put(task)
+				d.observer.TaskQueued(task.info())
+			}
+		} else if d.needRefresh(task) && !queued[task] {
+			d.queue.Put(task)
+			d.observer.TaskQueued(task.info())
+		}
+	}
+	return
+}
+
+// closeMap flush map to disk and close it
+func (d *Downloader) closeMap() error {
+	d.filesLock.Lock()
+	defer d.filesLock.Unlock()
+	if d.fMap == nil {
+		return nil
+	}
+	err := d.fMap.Sync()
+	if cerr := d.fMap.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// storeMap store task state in map
+func (d *Downloader) storeMap(task *task) error {
+	d.filesLock.Lock()
+	defer d.filesLock.Unlock()
+	return d._storeMap(task)
+}
+
+// internal method, need lock filesLock before
+func (d *Downloader) _storeMap(task *task) error {
+	if d.fMap == nil {
+		return nil
+	}
+	task.updated = time.Now()
+	_, err := d.fMap.Write([]byte(task.mapRecord()))
+	if err != nil {
+		d.runError(fmt.Errorf("map write: %s", err.Error()))
+		d.Abort()
+	}
+	return err
+}
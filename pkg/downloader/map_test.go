@@ -0,0 +1,338 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDownloader_Map(t *testing.T) {
+	var err error
+	d := NewDownloader(FlatMode, 1, time.Second, 1)
+	d.fMap, err = ioutil.TempFile("", "godownloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		d.closeMap()
+		os.Remove(d.fMap.Name())
+	}()
+
+	tests := []*task{
+		{url: "http://test.int/index.html", rootDir: "/", fileName: "index.html", contentType: "text/html",
+			links: 1, status: TaskOK, size: 591, try: 1, etag: `"5f4e"`, lastModified: "Sat, 22 Aug 2020 06:17:14 GMT"},
+		{url: "http://test.int/link1.html", rootDir: "/", root: "http://test.int/index.html", fileName: "link1.html", contentType: "text/html",
+			links: 2, downLevel: 1, extLinks: 1, status: TaskNew, try: 2},
+		{url: "http://test.int/1.gif", rootDir: "/", root: "http://test.int/index.html", referrer: "http://test.int/index.html",
+			fileName: "1.gif", contentType: "image/gif", status: TaskOK, size: 43, try: 1,
+			httpStatus: 200, attempts: 2, duration: 150 * time.Millisecond, tag: "img", attr: "src"},
+		{url: "http://test.int/not_found.html", rootDir: "/", status: TaskNotFound},
+		{url: "http://test.int/failed.html", rootDir: "/", links: 1, status: TaskFailed},
+		{url: "http://test.int/1.iso", rootDir: "/", links: 1, status: TaskSkipped},
+	}
+	skipped := []*task{
+		{url: "http://test.int/link2.html", root: "http://test.int/index.html", referrer: "http://test.int/link1.html",
+			status: TaskSkippedLevel},
+		{url: "http://test.int/1.zip", root: "http://test.int/index.html", referrer: "http://test.int/index.html",
+			status: TaskSkippedFilter},
+	}
+	for _, tt := range append(tests, skipped...) {
+		t.Run(tt.url, func(t *testing.T) {
+			err = d._storeMap(tt)
+			if err != nil {
+				t.Fatalf("Downloader._storeMap() error = %v", err)
+			}
+		})
+	}
+
+	// Verify
+	dv := NewDownloader(FlatMode, 3, time.Second, 1)
+
+	dv.AddRootURL("http://test.int/index.html", 1, 0, 0)
+	// root task already queued
+	dv.queue.TryGet()
+
+	dv.fileMap = d.fMap.Name()
+	err = dv.openMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dv.closeMap()
+	if err != nil {
+		t.Error(err)
+	}
+	if dv.processed.Len() != len(tests) {
+		t.Errorf("map length = %d, want %d", dv.processed.Len(), len(tests))
+	}
+	for _, task := range tests {
+		if lTask := dv.taskByURL(task.url); lTask == nil {
+			t.Errorf("map url %s not found", task.url)
+		} else {
+			if lTask.fileName != task.fileName {
+				t.Errorf("map url %s fileName  = '%s', want '%s'", task.url, lTask.fileName, task.fileName)
+			}
+			if lTask.contentType != task.contentType {
+				t.Errorf("map url %s contentType  = '%s', want '%s'", task.url, lTask.contentType, task.contentType)
+			}
+			if lTask.rootDir != task.rootDir {
+				t.Errorf("map url %s rootDir  = '%s', want '%s'", task.url, lTask.rootDir, task.rootDir)
+			}
+			if task.root != "" && lTask.root != task.root {
+				t.Errorf("map url %s root  = '%s', want '%s'", task.url, lTask.root, task.root)
+			}
+			if lTask.referrer != task.referrer {
+				t.Errorf("map url %s referrer  = '%s', want '%s'", task.url, lTask.referrer, task.referrer)
+			}
+			if lTask.tag != task.tag || lTask.attr != task.attr {
+				t.Errorf("map url %s tag attr  = '%s %s', want '%s %s'", task.url, lTask.tag, lTask.attr, task.tag, task.attr)
+			}
+			if lTask.httpStatus != task.httpStatus {
+				t.Errorf("map url %s httpStatus  = %d, want %d", task.url, lTask.httpStatus, task.httpStatus)
+			}
+			if lTask.attempts != task.attempts {
+				t.Errorf("map url %s attempts  = %d, want %d", task.url, lTask.attempts, task.attempts)
+			}
+			if lTask.duration != task.duration {
+				t.Errorf("map url %s duration  = %v, want %v", task.url, lTask.duration, task.duration)
+			}
+			if lTask.size != task.size {
+				t.Errorf("map url %s size  = %d, want %d", task.url, lTask.size, task.size)
+			}
+			if lTask.etag != task.etag {
+				t.Errorf("map url %s etag  = '%s', want '%s'", task.url, lTask.etag, task.etag)
+			}
+			if lTask.lastModified != task.lastModified {
+				t.Errorf("map url %s lastModified  = '%s', want '%s'", task.url, lTask.lastModified, task.lastModified)
+			}
+			if lTask.updated.IsZero() {
+				t.Errorf("map url %s updated not set", task.url)
+			}
+			status := task.status
+			try := task.try
+			if status == TaskFailed || status == TaskSkipped {
+				// failed and skipped tasks restarted
+				status = TaskNew
+				try = dv.retry
+			}
+			if lTask.status != status {
+				t.Errorf("map url %s status  = %s, want %s", task.url, lTask.status, status)
+			}
+			if lTask.try != try {
+				t.Errorf("map url %s try  = %d, want %d", task.url, lTask.try, try)
+			}
+			links := task.Links()
+			lLinks := lTask.Links()
+			downLevel := task.DownLevel()
+			lDownLevel := lTask.DownLevel()
+			extLinks := task.ExtLinks()
+			lExtLinks := lTask.ExtLinks()
+			if links != lLinks {
+				t.Errorf("map url %s links  = %d, want %d", task.url, lLinks, links)
+			}
+			if downLevel != lDownLevel {
+				t.Errorf("map url %s downLevel  = %d, want %d", task.url, lDownLevel, downLevel)
+			}
+			if extLinks != lExtLinks {
+				t.Errorf("map url %s extLinks  = %d, want %d", task.url, lExtLinks, extLinks)
+			}
+		}
+	}
+
+	for _, sTask := range skipped {
+		if v, ok := dv.skipped.Get(sTask.url); !ok {
+			t.Errorf("map skipped url %s not found", sTask.url)
+		} else if lTask := v.(*task); lTask.status != sTask.status || lTask.referrer != sTask.referrer {
+			t.Errorf("map skipped url %s = (%s, '%s'), want (%s, '%s')", sTask.url, lTask.status, lTask.referrer, sTask.status, sTask.referrer)
+		}
+	}
+
+	// unfinished tasks requeued
+	verifyQueue(t, dv, map[string]bool{
+		"http://test.int/link1.html":  true,
+		"http://test.int/failed.html": true,
+		"http://test.int/1.iso":       true,
+	})
+}
+
+func TestDownloader_MapLegacy(t *testing.T) {
+	f, err := ioutil.TempFile("", "godownloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("http://test.int/index.html\nindex.html text/html\n" +
+		"http://test.int/1.gif\n1.gif image/gif\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDownloader(FlatMode, 1, time.Second, 1)
+	d.AddRootURL("http://test.int/index.html", 2, 0, 0)
+	d.fileMap = f.Name()
+	err = d.openMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.closeMap()
+
+	tests := []struct {
+		url         string
+		fileName    string
+		contentType string
+		links       int32
+	}{
+		{"http://test.int/index.html", "index.html", "text/html", 2},
+		{"http://test.int/1.gif", "1.gif", "image/gif", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			task := d.taskByURL(tt.url)
+			if task == nil {
+				t.Fatalf("map url %s not found", tt.url)
+			}
+			if task.fileName != tt.fileName {
+				t.Errorf("map url %s fileName  = '%s', want '%s'", tt.url, task.fileName, tt.fileName)
+			}
+			if task.contentType != tt.contentType {
+				t.Errorf("map url %s contentType  = '%s', want '%s'", tt.url, task.contentType, tt.contentType)
+			}
+			if task.Links() != tt.links {
+				t.Errorf("map url %s links  = %d, want %d", tt.url, task.Links(), tt.links)
+			}
+			if task.protocol != HTTP {
+				t.Errorf("map url %s protocol  = %d, want %d", tt.url, task.protocol, HTTP)
+			}
+		})
+	}
+
+	// new record appended to legacy map
+	task := d.taskByURL("http://test.int/1.gif")
+	task.status = TaskOK
+	if err = d.storeMap(task); err != nil {
+		t.Fatal(err)
+	}
+	d.closeMap()
+	d.fMap = nil
+
+	dv := NewDownloader(FlatMode, 1, time.Second, 1)
+	dv.fileMap = f.Name()
+	if err = dv.openMap(); err != nil {
+		t.Fatal(err)
+	}
+	defer dv.closeMap()
+	if task = dv.taskByURL("http://test.int/1.gif"); task == nil || task.status != TaskOK {
+		t.Errorf("map url http://test.int/1.gif not updated")
+	}
+}
+
+func TestDownloader_MapIncomplete(t *testing.T) {
+	f, err := ioutil.TempFile("", "godownloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	task := newLoadTask("http://test.int/index.html", "/", 1, 0, 0, 1)
+	task.fileName = "index.html"
+	task.contentType = "text/html"
+	task.status = TaskOK
+	record := task.mapRecord()
+	// interrupted write
+	_, err = f.WriteString(record + "v2\thttp://test.int/1.gif\t/\t1.gif")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDownloader(FlatMode, 1, time.Second, 1)
+	d.AddRootURL("http://test.int/index.html", 2, 0, 0)
+	d.fileMap = f.Name()
+	if err = d.openMap(); err != nil {
+		t.Fatal(err)
+	}
+	if task = d.taskByURL("http://test.int/index.html"); task == nil || task.status != TaskOK {
+		t.Errorf("map url http://test.int/index.html not loaded")
+	}
+	if task = d.taskByURL("http://test.int/1.gif"); task != nil {
+		t.Errorf("map url http://test.int/1.gif loaded from incomplete record")
+	}
+
+	// incomplete record truncated, new record appended after last complete record
+	task = newLoadTask("http://test.int/1.gif", "/", 0, 0, 0, 1)
+	if err = d.storeMap(task); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.closeMap(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := record + task.mapRecord(); string(data) != want {
+		t.Errorf("map = '%s', want '%s'", string(data), want)
+	}
+}
+
+func TestDownloader_MapFileNames(t *testing.T) {
+	f, err := ioutil.TempFile("", "godownloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	gif := newLoadTask("http://test.int/img/a.gif", "/", 0, 0, 0, 1)
+	gif.fileName = "a.gif"
+	gif.contentType = "image/gif"
+	gif.status = TaskOK
+	png := newLoadTask("http://test.int/b.png", "/", 0, 0, 0, 1)
+	png.fileName = "b.png"
+	png.contentType = "image/png"
+	record := gif.mapRecord() + png.mapRecord()
+	// file renamed in later record
+	png.fileName = "b-1.png"
+	if _, err = f.WriteString(record + png.mapRecord()); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	d := NewDownloader(FlatMode, 1, time.Second, 1)
+	d.outdir = tmpdir
+	d.fileMap = f.Name()
+	if err = d.openMap(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.closeMap()
+
+	tests := []struct {
+		url          string
+		contentType  string
+		wantFileName string
+	}{
+		// loaded file name not reused
+		{"http://test.int/css/a.gif", "image/gif", "a-1.gif"},
+		// stale file name (before rename) is free
+		{"http://test.int/img/b.png", "image/png", "b.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			task := newLoadTask(tt.url, "/", 0, 0, 0, 1)
+			task.contentType = tt.contentType
+			d.filesLock.Lock()
+			err := d._genTaskFileName(task)
+			d.filesLock.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if task.fileName != tt.wantFileName {
+				t.Errorf("Downloader._genTaskFileName() = '%s', want '%s'", task.fileName, tt.wantFileName)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package downloader
+
+import (
+	"io"
+	"net/http"
+)
+
+// TaskInfo task state snapshot for observer
+type TaskInfo struct {
+	URL         string
+	Root        string // root url
+	FileName    string // relative filename (blank if not downloaded)
+	ContentType string
+	Size        int64 // size from header (or saved file size)
+	Try         int   // remaining retry count
+	Status      TaskStatus
+}
+
+// Observer task lifecycle events receiver.
+// Callbacks called from worker goroutines (so must be safe for concurrent use) and must not block.
+type Observer interface {
+	// TaskQueued new task queued (or requeued after levels changed, info has only URL and Root, task may be running)
+	TaskQueued(info TaskInfo)
+	// TaskStarted download (or conditional request in update mode) started
+	TaskStarted(info TaskInfo)
+	// TaskResponse response headers received
+	TaskResponse(info TaskInfo, statusCode int, header http.Header)
+	// TaskProgress bytes read from response body (with resume offset), total is -1 if unknown
+	TaskProgress(info TaskInfo, bytes int64, total int64)
+	// TaskSaved file saved
+	TaskSaved(info TaskInfo)
+	// TaskSkipped task skipped by quotas (or url skipped by level, filters or robots.txt, reported once)
+	TaskSkipped(info TaskInfo, reason string)
+	// TaskFailed task failed (retried, if info.Try > 0)
+	TaskFailed(info TaskInfo, err error)
+}
+
+// NopObserver observer with empty callbacks (for embed in partial observers)
+type NopObserver struct{}
+
+func (NopObserver) TaskQueued(info TaskInfo)                                       {}
+func (NopObserver) TaskStarted(info TaskInfo)                                      {}
+func (NopObserver) TaskResponse(info TaskInfo, statusCode int, header http.Header) {}
+func (NopObserver) TaskProgress(info TaskInfo, bytes int64, total int64)           {}
+func (NopObserver) TaskSaved(info TaskInfo)                                        {}
+func (NopObserver) TaskSkipped(info TaskInfo, reason string)                       {}
+func (NopObserver) TaskFailed(info TaskInfo, err error)                            {}
+
+// SetObserver set task lifecycle events receiver
+func (d *Downloader) SetObserver(observer Observer) *Downloader {
+	if observer == nil {
+		observer = NopObserver{}
+	}
+	d.observer = observer
+	return d
+}
+
+func (task *task) info() TaskInfo {
+	return TaskInfo{
+		URL: task.url, Root: task.root,
+		FileName: task.fileName, ContentType: task.contentType,
+		Size: task.size, Try: task.try, Status: task.status,
+	}
+}
+
+// requeueInfo return immutable task fields (for requeued task, which may be running)
+func (task *task) requeueInfo() TaskInfo {
+	return TaskInfo{URL: task.url, Root: task.root}
+}
+
+// progressReader report read progress to observer
+type progressReader struct {
+	r     io.Reader
+	d     *Downloader
+	task  *task
+	size  int64 // read bytes (with resume offset)
+	total int64
+}
+
+func (d *Downloader) newProgressReader(r io.Reader, task *task, offset int64, total int64) *progressReader {
+	return &progressReader{r: r, d: d, task: task, size: offset, total: total}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.size += int64(n)
+		p.d.observer.TaskProgress(p.task.info(), p.size, p.total)
+	}
+	return n, err
+}
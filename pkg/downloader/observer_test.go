@@ -0,0 +1,151 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testObserver record observer events by url
+type testObserver struct {
+	lock     sync.Mutex
+	events   map[string][]string
+	progress map[string]int64
+	saved    map[string]TaskInfo
+	failed   map[string]TaskInfo
+	skipped  map[string]string
+}
+
+func newTestObserver() *testObserver {
+	return &testObserver{
+		events:   make(map[string][]string),
+		progress: make(map[string]int64),
+		saved:    make(map[string]TaskInfo),
+		failed:   make(map[string]TaskInfo),
+		skipped:  make(map[string]string),
+	}
+}
+
+func (o *testObserver) event(url, event string) {
+	o.lock.Lock()
+	events := o.events[url]
+	// progress events collapsed
+	if event != "progress" || len(events) == 0 || events[len(events)-1] != "progress" {
+		o.events[url] = append(events, event)
+	}
+	o.lock.Unlock()
+}
+
+func (o *testObserver) TaskQueued(info TaskInfo) {
+	o.event(info.URL, "queued")
+}
+
+func (o *testObserver) TaskStarted(info TaskInfo) {
+	o.event(info.URL, "started")
+}
+
+func (o *testObserver) TaskResponse(info TaskInfo, statusCode int, header http.Header) {
+	o.event(info.URL, "response")
+}
+
+func (o *testObserver) TaskProgress(info TaskInfo, bytes int64, total int64) {
+	o.event(info.URL, "progress")
+	o.lock.Lock()
+	o.progress[info.URL] = bytes
+	o.lock.Unlock()
+}
+
+func (o *testObserver) TaskSaved(info TaskInfo) {
+	o.event(info.URL, "saved")
+	o.lock.Lock()
+	o.saved[info.URL] = info
+	o.lock.Unlock()
+}
+
+func (o *testObserver) TaskSkipped(info TaskInfo, reason string) {
+	o.event(info.URL, "skipped")
+	o.lock.Lock()
+	o.skipped[info.URL] = reason
+	o.lock.Unlock()
+}
+
+func (o *testObserver) TaskFailed(info TaskInfo, err error) {
+	o.event(info.URL, "failed")
+	o.lock.Lock()
+	o.failed[info.URL] = info
+	o.lock.Unlock()
+}
+
+func TestDownloader_Observer(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	o := newTestObserver()
+	d := NewDownloader(FlatMode, 2, time.Second, 2).SetObserver(o)
+	if err = d.SetQuotas(Quotas{DenyTypes: []string{"image/*"}}); err != nil {
+		t.Fatal(err)
+	}
+	d.AddRootURL(baseAddr+"/index.html", 2, 0, 0)
+	if _, err = d.NewLoad(tmpdir+"/out", "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = d.SetParallel(2).Run(context.Background())
+
+	savedEvents := []string{"queued", "started", "response", "progress", "saved"}
+	tests := []struct {
+		url         string
+		events      []string
+		contentType string
+		size        int64
+	}{
+		{"/index.html", savedEvents, "text/html", 591},
+		{"/style.css", savedEvents, "text/css", 71},
+		{"/1.gz", savedEvents, "application/gzip", 52},
+		{"/1.gif", []string{"queued", "started", "response", "skipped"}, "", 0},
+		{"/not_found.html", []string{"queued", "started", "response", "failed"}, "", 0},
+		{"/link2.html", []string{"skipped"}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			url := baseAddr + tt.url
+			events := o.events[url]
+			if len(events) != len(tt.events) {
+				t.Fatalf("observer events = %v, want %v", events, tt.events)
+			}
+			for i := range events {
+				if events[i] != tt.events[i] {
+					t.Fatalf("observer events = %v, want %v", events, tt.events)
+				}
+			}
+			if info, ok := o.saved[url]; ok {
+				if info.ContentType != tt.contentType || info.Size != tt.size || len(info.FileName) == 0 || info.Status != TaskOK {
+					t.Errorf("observer saved = %+v, want content type %s, size %d", info, tt.contentType, tt.size)
+				}
+				if o.progress[url] != tt.size {
+					t.Errorf("observer progress = %d, want %d", o.progress[url], tt.size)
+				}
+			}
+			if info, ok := o.failed[url]; ok && (info.Try != 0 || info.Status != TaskNotFound) {
+				t.Errorf("observer failed = %+v, want not found with try 0", info)
+			}
+		})
+	}
+	if len(o.skipped[baseAddr+"/1.gif"]) == 0 {
+		t.Errorf("observer skipped reason not set")
+	}
+	if reason := o.skipped[baseAddr+"/link2.html"]; reason != "links level exhausted" {
+		t.Errorf("observer skipped reason = '%s', want '%s'", reason, "links level exhausted")
+	}
+}
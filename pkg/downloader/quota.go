@@ -0,0 +1,160 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sync/atomic"
+)
+
+// Quotas download limits (0 or empty for unlimited), tasks over quota are skipped
+type Quotas struct {
+	MaxFileSize  int64    // max file size
+	AllowTypes   []string // allowed content types (glob patterns, like image/*)
+	DenyTypes    []string // denied content types (glob patterns, like video/*)
+	MaxBytes     int64    // max total downloaded bytes per run
+	MaxHostBytes int64    // max downloaded bytes per host per run
+	MaxFiles     int64    // max downloaded files per run
+}
+
+// quotaError quota exceeded (task skipped, not failed)
+type quotaError struct {
+	reason string
+}
+
+func (e *quotaError) Error() string {
+	return e.reason
+}
+
+func isQuotaError(err error) bool {
+	_, ok := err.(*quotaError)
+	return ok
+}
+
+// SetQuotas set download limits
+func (d *Downloader) SetQuotas(quotas Quotas) error {
+	for _, patterns := range [][]string{quotas.AllowTypes, quotas.DenyTypes} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid content type pattern '%s': %s", p, err.Error())
+			}
+		}
+	}
+	d.quotas = quotas
+	return nil
+}
+
+func matchContentType(patterns []string, contentType string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, contentType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContentType check content type with allowed and denied lists
+func (d *Downloader) checkContentType(contentType string) error {
+	if matchContentType(d.quotas.DenyTypes, contentType) {
+		return &quotaError{"content type " + contentType + " denied"}
+	}
+	if len(d.quotas.AllowTypes) > 0 && !matchContentType(d.quotas.AllowTypes, contentType) {
+		return &quotaError{"content type " + contentType + " not allowed"}
+	}
+	return nil
+}
+
+// checkQuotas check already exhausted quotas before request
+func (d *Downloader) checkQuotas(task *task) error {
+	if d.quotas.MaxFiles > 0 && task.status != TaskOK && atomic.LoadInt64(&d.fileCount) >= d.quotas.MaxFiles {
+		return &quotaError{"max files quota exceeded"}
+	}
+	if d.quotas.MaxBytes > 0 && atomic.LoadInt64(&d.bytes) >= d.quotas.MaxBytes {
+		return &quotaError{"max bytes quota exceeded"}
+	}
+	if d.quotas.MaxHostBytes > 0 && task.protocol == HTTP &&
+		atomic.LoadInt64(&d.hostLimiter(urlHost(task.url)).bytes) >= d.quotas.MaxHostBytes {
+		return &quotaError{"max host bytes quota exceeded"}
+	}
+	return nil
+}
+
+// checkSize check file size and remaining bytes quotas
+func (d *Downloader) checkSize(task *task, size int64) error {
+	if d.quotas.MaxFileSize > 0 && size > d.quotas.MaxFileSize {
+		return &quotaError{fmt.Sprintf("file size %d exceed max file size quota", size)}
+	}
+	if d.quotas.MaxBytes > 0 && atomic.LoadInt64(&d.bytes)+size > d.quotas.MaxBytes {
+		return &quotaError{"max bytes quota exceeded"}
+	}
+	if d.quotas.MaxHostBytes > 0 &&
+		atomic.LoadInt64(&d.hostLimiter(urlHost(task.url)).bytes)+size > d.quotas.MaxHostBytes {
+		return &quotaError{"max host bytes quota exceeded"}
+	}
+	return nil
+}
+
+// checkDownload check response content type and size (Content-Length with resume offset) before download
+func (d *Downloader) checkDownload(task *task, offset int64, contentLength int64) error {
+	if err := d.checkContentType(task.contentType); err != nil {
+		return err
+	}
+	if contentLength >= 0 {
+		if err := d.checkSize(task, offset+contentLength); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquireFile count new downloaded file for max files quota (must be released with releaseFile, if download failed)
+func (d *Downloader) acquireFile() error {
+	if atomic.AddInt64(&d.fileCount, 1) > d.quotas.MaxFiles && d.quotas.MaxFiles > 0 {
+		atomic.AddInt64(&d.fileCount, -1)
+		return &quotaError{"max files quota exceeded"}
+	}
+	return nil
+}
+
+// releaseFile uncount file, acquired by acquireFile, if task not downloaded (file counted once on success)
+func (d *Downloader) releaseFile(task *task) {
+	if task.status != TaskOK {
+		atomic.AddInt64(&d.fileCount, -1)
+	}
+}
+
+// quotaReader enforce size quotas while streaming response body
+type quotaReader struct {
+	r         io.Reader
+	d         *Downloader
+	hostBytes *int64
+	size      int64 // file size (with resume offset)
+}
+
+func (d *Downloader) newQuotaReader(r io.Reader, task *task, offset int64) *quotaReader {
+	q := &quotaReader{r: r, d: d, size: offset}
+	if task.protocol == HTTP {
+		q.hostBytes = &d.hostLimiter(urlHost(task.url)).bytes
+	}
+	return q
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	if n > 0 {
+		quotas := &q.d.quotas
+		q.size += int64(n)
+		if quotas.MaxFileSize > 0 && q.size > quotas.MaxFileSize {
+			return n, &quotaError{"max file size quota exceeded"}
+		}
+		if total := atomic.AddInt64(&q.d.bytes, int64(n)); quotas.MaxBytes > 0 && total > quotas.MaxBytes {
+			return n, &quotaError{"max bytes quota exceeded"}
+		}
+		if q.hostBytes != nil {
+			if total := atomic.AddInt64(q.hostBytes, int64(n)); quotas.MaxHostBytes > 0 && total > quotas.MaxHostBytes {
+				return n, &quotaError{"max host bytes quota exceeded"}
+			}
+		}
+	}
+	return n, err
+}
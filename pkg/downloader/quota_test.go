@@ -0,0 +1,208 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloader_quotas(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	tests := []struct {
+		name    string
+		quotas  Quotas
+		skipped []string
+		ok      []string
+		failed  bool // not_found.html failed
+	}{
+		{
+			name:    "deny types",
+			quotas:  Quotas{DenyTypes: []string{"image/*"}},
+			skipped: []string{"/1.gif"},
+			ok:      []string{"/index.html", "/style.css", "/1.gz", "/link1.html", "/link2.html"},
+			failed:  true,
+		},
+		{
+			name:    "allow types",
+			quotas:  Quotas{AllowTypes: []string{"text/*"}},
+			skipped: []string{"/1.gif", "/1.gz"},
+			ok:      []string{"/index.html", "/style.css", "/link1.html", "/link2.html"},
+			failed:  true,
+		},
+		{
+			name:    "max file size",
+			quotas:  Quotas{MaxFileSize: 500},
+			skipped: []string{"/index.html"},
+		},
+		{
+			name:    "max files",
+			quotas:  Quotas{MaxFiles: 1},
+			skipped: []string{"/style.css", "/1.gif", "/1.gz", "/link1.html"},
+			ok:      []string{"/index.html"},
+		},
+		// index.html (591 bytes) and style.css (71 bytes) loaded first
+		{
+			name:    "max bytes",
+			quotas:  Quotas{MaxBytes: 700},
+			skipped: []string{"/1.gif", "/1.gz", "/link1.html"},
+			ok:      []string{"/index.html", "/style.css"},
+			failed:  true,
+		},
+		{
+			name:    "max host bytes",
+			quotas:  Quotas{MaxHostBytes: 700},
+			skipped: []string{"/1.gif", "/1.gz", "/link1.html"},
+			ok:      []string{"/index.html", "/style.css"},
+			failed:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, err := ioutil.TempDir("", "godownloader-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpdir)
+			dir := tmpdir + "/" + "out"
+
+			d := NewDownloader(FlatMode, 1, time.Second, 2)
+			if err = d.SetQuotas(tt.quotas); err != nil {
+				t.Fatal(err)
+			}
+			d.AddRootURL(baseAddr+"/index.html", 3, 0, 0)
+			if _, err = d.NewLoad(dir, "godownloader.map"); err != nil {
+				t.Fatal(err)
+			}
+			// one thread for predictable download order
+			d.Start(1)
+			// skipped tasks is not failures
+			if failed := d.Wait(); failed != tt.failed {
+				t.Errorf("Downloader.Wait() = %v, want %v", failed, tt.failed)
+			}
+
+			for _, url := range tt.skipped {
+				task := d.taskByURL(baseAddr + url)
+				if task == nil {
+					t.Errorf("%s not processed", url)
+				} else if task.status != TaskSkipped {
+					t.Errorf("%s status = %s, want %s", url, task.status, TaskSkipped)
+				} else if len(task.fileName) > 0 {
+					if _, err := os.Stat(dir + "/" + task.fileName); !os.IsNotExist(err) {
+						t.Errorf("%s file %s exist for skipped task", url, task.fileName)
+					}
+				}
+			}
+			for _, url := range tt.ok {
+				task := d.taskByURL(baseAddr + url)
+				if task == nil {
+					t.Errorf("%s not processed", url)
+				} else if task.status != TaskOK {
+					t.Errorf("%s status = %s, want %s", url, task.status, TaskOK)
+				}
+			}
+		})
+	}
+}
+
+// failed attempts not counted in max files quota
+func TestDownloader_quotasMaxFilesRetry(t *testing.T) {
+	var broken int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.html", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><img src="1.gif"><img src="2.gif"></body></html>`))
+	})
+	mux.HandleFunc("/1.gif", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Content-Length", "100")
+		if atomic.AddInt32(&broken, 1) == 1 {
+			// connection closed in middle of body
+			w.Write([]byte(strings.Repeat("x", 10)))
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 100)))
+	})
+	mux.HandleFunc("/2.gif", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(strings.Repeat("x", 100)))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	d := NewDownloader(FlatMode, 2, time.Second, 2)
+	if err = d.SetQuotas(Quotas{MaxFiles: 3}); err != nil {
+		t.Fatal(err)
+	}
+	d.AddRootURL(baseAddr+"/index.html", 1, 0, 0)
+	if _, err = d.NewLoad(tmpdir+"/out", "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	// one thread for predictable download order (1.gif retried after 2.gif)
+	d.Start(1)
+	d.Wait()
+	if n := atomic.LoadInt32(&broken); n != 2 {
+		t.Errorf("/1.gif requested %d times, want 2", n)
+	}
+	for _, url := range []string{"/index.html", "/1.gif", "/2.gif"} {
+		task := d.taskByURL(baseAddr + url)
+		if task == nil {
+			t.Errorf("%s not processed", url)
+		} else if task.status != TaskOK {
+			t.Errorf("%s status = %s, want %s", url, task.status, TaskOK)
+		}
+	}
+	if n := atomic.LoadInt64(&d.fileCount); n != 3 {
+		t.Errorf("Downloader fileCount = %d, want 3", n)
+	}
+}
+
+func Test_quotaReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		quotas  Quotas
+		offset  int64
+		wantErr bool
+	}{
+		{"unlimited", Quotas{}, 0, false},
+		{"max file size", Quotas{MaxFileSize: 10}, 0, false},
+		{"max file size exceeded", Quotas{MaxFileSize: 9}, 0, true},
+		{"max file size exceeded with offset", Quotas{MaxFileSize: 10}, 1, true},
+		{"max bytes exceeded", Quotas{MaxBytes: 5}, 0, true},
+		{"max host bytes exceeded", Quotas{MaxHostBytes: 5}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(FlatMode, 1, time.Second, 2)
+			if err := d.SetQuotas(tt.quotas); err != nil {
+				t.Fatal(err)
+			}
+			task := newLoadTask("http://test.int/1.bin", "/", 1, 0, 0, 1)
+			r := d.newQuotaReader(strings.NewReader("0123456789"), task, tt.offset)
+			_, err := ioutil.ReadAll(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("quotaReader read error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !isQuotaError(err) {
+				t.Errorf("quotaReader read error = %v, want quota error", err)
+			}
+		})
+	}
+}
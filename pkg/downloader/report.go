@@ -0,0 +1,186 @@
+package downloader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// ReportJSONFile run report in JSON format (in output dir)
+	ReportJSONFile = "godownloader.report.json"
+	// ReportCSVFile run report in CSV format (in output dir)
+	ReportCSVFile = "godownloader.report.csv"
+)
+
+// ReportTask task result
+type ReportTask struct {
+	URL         string     `json:"url"`
+	FileName    string     `json:"file_name"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	HTTPStatus  int        `json:"http_status"`
+	Attempts    int        `json:"attempts"`
+	Duration    int64      `json:"duration_ms"` // summary duration of attempts in milliseconds
+	Referrer    string     `json:"referrer"`    // page, where url found (blank for root urls)
+	State       TaskStatus `json:"state"`
+}
+
+// ReportTotals aggregate totals by final state
+type ReportTotals struct {
+	Tasks         int   `json:"tasks"`
+	OK            int   `json:"ok"`
+	NotFound      int   `json:"not_found"`
+	Skipped       int   `json:"skipped"`
+	SkippedLevel  int   `json:"skipped_level"`
+	SkippedFilter int   `json:"skipped_filter"`
+	Failed        int   `json:"failed"`
+	New           int   `json:"new"` // not completed (aborted) tasks
+	Size          int64 `json:"size"`
+	Attempts      int   `json:"attempts"`
+	Duration      int64 `json:"duration_ms"`
+}
+
+// Report run report
+type Report struct {
+	Generated time.Time    `json:"generated"`
+	Totals    ReportTotals `json:"totals"`
+	Tasks     []ReportTask `json:"tasks"`
+}
+
+// MarshalJSON marshal status as string
+func (s TaskStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON unmarshal status from string
+func (s *TaskStatus) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	return s.Set(value)
+}
+
+func (task *task) reportTask() ReportTask {
+	return ReportTask{
+		URL: task.url, FileName: task.fileName, ContentType: task.contentType,
+		Size: task.size, HTTPStatus: task.httpStatus, Attempts: task.attempts,
+		Duration: int64(task.duration / time.Millisecond),
+		Referrer: task.referrer, State: task.status,
+	}
+}
+
+func (t *ReportTotals) add(task *ReportTask) {
+	t.Tasks++
+	switch task.State {
+	case TaskOK:
+		t.OK++
+	case TaskNotFound:
+		t.NotFound++
+	case TaskSkipped:
+		t.Skipped++
+	case TaskSkippedLevel:
+		t.SkippedLevel++
+	case TaskSkippedFilter:
+		t.SkippedFilter++
+	case TaskFailed:
+		t.Failed++
+	default:
+		t.New++
+	}
+	t.Size += task.Size
+	t.Attempts += task.Attempts
+	t.Duration += task.Duration
+}
+
+// Report build report for processed and skipped urls (sorted by url), not safe for use with running downloader
+func (d *Downloader) Report() *Report {
+	r := &Report{Generated: time.Now(), Tasks: make([]ReportTask, 0, d.processed.Len()+d.skipped.Len())}
+	for kv := range d.processed.Iter() {
+		r.Tasks = append(r.Tasks, kv.Value.(*task).reportTask())
+	}
+	for kv := range d.skipped.Iter() {
+		// url can be processed later (after levels changed)
+		if _, ok := d.processed.Get(kv.Key); !ok {
+			r.Tasks = append(r.Tasks, kv.Value.(*task).reportTask())
+		}
+	}
+	sort.Slice(r.Tasks, func(i, j int) bool { return r.Tasks[i].URL < r.Tasks[j].URL })
+	for i := range r.Tasks {
+		r.Totals.add(&r.Tasks[i])
+	}
+	return r
+}
+
+// WriteJSON write report in JSON format
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV write report tasks in CSV format (with header)
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{
+		"url", "file_name", "content_type", "size", "http_status", "attempts", "duration_ms", "referrer", "state",
+	})
+	if err != nil {
+		return err
+	}
+	for i := range r.Tasks {
+		t := &r.Tasks[i]
+		err = cw.Write([]string{
+			t.URL, t.FileName, t.ContentType, strconv.FormatInt(t.Size, 10), strconv.Itoa(t.HTTPStatus),
+			strconv.Itoa(t.Attempts), strconv.FormatInt(t.Duration, 10), t.Referrer, t.State.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeReportFile(fileName string, write func(w io.Writer) error) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SaveReport write JSON and CSV reports into output dir
+func (d *Downloader) SaveReport() error {
+	if len(d.outdir) == 0 {
+		return fmt.Errorf("outdir not set")
+	}
+	r := d.Report()
+	if err := writeReportFile(d.outdir+"/"+ReportJSONFile, r.WriteJSON); err != nil {
+		return err
+	}
+	return writeReportFile(d.outdir+"/"+ReportCSVFile, r.WriteCSV)
+}
+
+// ReportLoad builder for report from existing load (map is read-only, no downloads)
+func (d *Downloader) ReportLoad(dir string, fileMap string) (*Downloader, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("output dir not set")
+	}
+	d.outdir = dir
+	d.fileMap = dir + "/" + fileMap
+	if err := d.loadMap(d.fileMap); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,123 @@
+package downloader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownloader_Report(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := tmpdir + "/" + "out"
+
+	d := NewDownloader(FlatMode, 1, time.Second, 2)
+	d.AddRootURL(baseAddr+"/index.html", 2, 0, 0)
+	if err = d.SetURLFilters(baseAddr+"/index.html", nil, []Filter{{Target: FilterPath, Glob: "*.gz"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.NewLoad(dir, "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	d.Start(1)
+	// not_found.html failed
+	if failed := d.Wait(); !failed {
+		t.Errorf("Downloader.Wait() = %v, want %v", failed, true)
+	}
+
+	type result struct {
+		fileName   string
+		httpStatus int
+		attempts   int
+		referrer   string
+		state      TaskStatus
+	}
+	want := map[string]result{
+		"/index.html":     {"index.html", 200, 1, "", TaskOK},
+		"/style.css":      {"style.css", 200, 1, "/index.html", TaskOK},
+		"/1.gif":          {"1.gif", 200, 1, "/index.html", TaskOK},
+		"/1.gz":           {"", 0, 0, "/index.html", TaskSkippedFilter},
+		"/link1.html":     {"link1.html", 200, 1, "/index.html", TaskOK},
+		"/link2.html":     {"", 0, 0, "/link1.html", TaskSkippedLevel},
+		"/not_found.html": {"", 404, 1, "/index.html", TaskNotFound},
+	}
+	wantTotals := ReportTotals{Tasks: 7, OK: 4, NotFound: 1, SkippedLevel: 1, SkippedFilter: 1, Size: 591 + 71 + 169 + 424, Attempts: 5}
+
+	data, err := ioutil.ReadFile(dir + "/" + ReportJSONFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err = json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	// durations depends on speed
+	report.Totals.Duration = 0
+	if report.Totals != wantTotals {
+		t.Errorf("report totals = %+v, want %+v", report.Totals, wantTotals)
+	}
+	if len(report.Tasks) != len(want) {
+		t.Errorf("report tasks = %d, want %d", len(report.Tasks), len(want))
+	}
+	for i, task := range report.Tasks {
+		if i > 0 && report.Tasks[i-1].URL >= task.URL {
+			t.Errorf("report tasks not sorted: %s before %s", report.Tasks[i-1].URL, task.URL)
+		}
+		url := task.URL[len(baseAddr):]
+		r, ok := want[url]
+		if !ok {
+			t.Errorf("report url %s unexpected", url)
+			continue
+		}
+		if len(r.referrer) > 0 {
+			r.referrer = baseAddr + r.referrer
+		}
+		got := result{task.FileName, task.HTTPStatus, task.Attempts, task.Referrer, task.State}
+		if got != r {
+			t.Errorf("report url %s = %+v, want %+v", url, got, r)
+		}
+	}
+
+	f, err := os.Open(dir + "/" + ReportCSVFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(f).ReadAll()
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(want)+1 {
+		t.Errorf("csv report records = %d, want %d", len(records), len(want)+1)
+	} else {
+		for i, task := range report.Tasks {
+			if records[i+1][0] != task.URL || records[i+1][8] != task.State.String() {
+				t.Errorf("csv report record %d = %v, want %s %s", i+1, records[i+1], task.URL, task.State)
+			}
+		}
+	}
+
+	// regenerate from map
+	dr := NewDownloader(FlatMode, 1, time.Second, 2)
+	dr.AddRootURL(baseAddr+"/index.html", 2, 0, 0)
+	if _, err = dr.ReportLoad(dir, "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	got := dr.Report()
+	if !reflect.DeepEqual(got.Tasks, report.Tasks) {
+		t.Errorf("regenerated report tasks = %+v, want %+v", got.Tasks, report.Tasks)
+	}
+}
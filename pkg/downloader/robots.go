@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/msaf1980/godownloader/pkg/robots"
+	"github.com/msaf1980/godownloader/pkg/urlutils"
+)
+
+// hostRobots cached robots.txt rules for host
+type hostRobots struct {
+	once   sync.Once
+	robots *robots.Robots
+
+	lock sync.Mutex
+	next time.Time // next request time (for crawl-delay)
+}
+
+// hostRobots return robots.txt rules for host (scheme + host), load on first access
+func (d *Downloader) hostRobots(host string) *hostRobots {
+	v, _ := d.robots.GetOrInsert(host, &hostRobots{})
+	h := v.(*hostRobots)
+	h.once.Do(func() {
+		h.robots = d.loadRobots(host)
+	})
+	return h
+}
+
+func (d *Downloader) loadRobots(host string) *robots.Robots {
+	url := host + "/robots.txt"
+	req, err := d.newRequest(url)
+	if err != nil {
+		d.logger.Warn().Str("url", url).Msg(err.Error())
+		return robots.AllowAll()
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		d.logger.Warn().Str("url", url).Msg(err.Error())
+		return robots.AllowAll()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		d.logger.Debug().Str("url", url).Int("status", resp.StatusCode).Msg("robots.txt not loaded")
+		return robots.AllowAll()
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		d.logger.Warn().Str("url", url).Msg(err.Error())
+		return robots.AllowAll()
+	}
+	return robots.Parse(data, d.userAgent)
+}
+
+// robotsAllowed check url access by robots.txt
+func (d *Downloader) robotsAllowed(url string) bool {
+	if d.ignoreRobots || URLProtocol(url) != HTTP {
+		return true
+	}
+	host, path := urlutils.SplitURL(url)
+	return d.hostRobots(host).robots.Allowed(path)
+}
+
+// crawlDelay wait for robots.txt crawl-delay from previous request to host (interrupted on abort)
+func (d *Downloader) crawlDelay(url string) error {
+	if d.ignoreRobots || URLProtocol(url) != HTTP {
+		return nil
+	}
+	host, _ := urlutils.SplitURL(url)
+	h := d.hostRobots(host)
+	if h.robots.CrawlDelay == 0 {
+		return nil
+	}
+	h.lock.Lock()
+	now := time.Now()
+	wait := h.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	h.next = now.Add(wait + h.robots.CrawlDelay)
+	h.lock.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		}
+	}
+	return nil
+}
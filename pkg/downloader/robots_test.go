@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloader_robots(t *testing.T) {
+	robotsLoads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/robots.txt" {
+			robotsLoads++
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\nCrawl-delay: 0.1\n")
+			return
+		}
+		http.NotFound(w, req)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		ignoreRobots bool
+		url          string
+		want         bool
+	}{
+		{"allowed", false, ts.URL + "/index.html", true},
+		{"disallowed", false, ts.URL + "/private/index.html", false},
+		{"ignore robots", true, ts.URL + "/private/index.html", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(FlatMode, 1, time.Second, 1).SetIgnoreRobots(tt.ignoreRobots)
+			if got := d.addURL(tt.url, true, 1, ts.URL, "/", "", linkSource{}, 2, 0, 0); got != tt.want {
+				t.Errorf("Downloader.addURL() = %v, want %v", got, tt.want)
+			}
+			if got := d.taskByURL(tt.url) != nil; got != tt.want {
+				t.Errorf("Downloader.addURL() task added = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// robots.txt cached
+	robotsLoads = 0
+	d := NewDownloader(FlatMode, 1, time.Second, 1)
+	d.addURL(ts.URL+"/1.html", true, 1, ts.URL, "/", "", linkSource{}, 2, 0, 0)
+	d.addURL(ts.URL+"/2.html", true, 1, ts.URL, "/", "", linkSource{}, 2, 0, 0)
+	if robotsLoads != 1 {
+		t.Errorf("robots.txt loaded %d times, want 1", robotsLoads)
+	}
+
+	// crawl-delay
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := d.crawlDelay(ts.URL + "/index.html"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("crawl-delay elapsed %v, want >= 200ms", elapsed)
+	}
+}
+
+func TestDownloader_crawlDelayAbort(t *testing.T) {
+	loaded := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nCrawl-delay: 60\n")
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><body><a href="1.html">1</a></body></html>`)
+			close(loaded)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer ts.Close()
+
+	d := NewDownloader(FlatMode, 1, time.Second, 1)
+	d.AddRootURL(ts.URL+"/index.html", 2, 0, 0)
+	if _, err := d.CheckLoad(); err != nil {
+		t.Fatal(err)
+	}
+	d.Start(1)
+	select {
+	case <-loaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("index.html not loaded")
+	}
+	// 1.html request wait for crawl-delay
+	time.Sleep(50 * time.Millisecond)
+	d.Abort()
+
+	done := make(chan bool)
+	go func() {
+		done <- d.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Downloader.Wait() not completed after abort during crawl-delay")
+	}
+}
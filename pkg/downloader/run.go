@@ -0,0 +1,191 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNotFound url not found
+	ErrNotFound = errors.New("Not found")
+	// ErrAborted download aborted
+	ErrAborted = errors.New("aborted")
+	// ErrStarted download already started
+	ErrStarted = errors.New("already started")
+)
+
+// StatusError unexpected http status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return "Failed with http status " + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+}
+
+// URLError url download (or process) error
+type URLError struct {
+	URL  string
+	File string // relative filename (blank if not downloaded)
+	Err  error
+}
+
+func (e *URLError) Error() string {
+	return e.URL + ": " + e.Err.Error()
+}
+
+func (e *URLError) Unwrap() error {
+	return e.Err
+}
+
+// Errors aggregated url errors
+type Errors []*URLError
+
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%d urls failed, first %s", len(e), e[0].Error())
+	}
+}
+
+// taskCounters atomic task results counters
+type taskCounters struct {
+	done        int64
+	notModified int64
+	skipped     int64
+	notFound    int64
+	failed      int64
+}
+
+// Stats download statistic
+type Stats struct {
+	Done        int64 // downloaded (or updated) files
+	NotModified int64 // not modified files (in update mode)
+	Skipped     int64 // tasks, skipped by quotas
+	NotFound    int64 // not found urls
+	Failed      int64 // failed tasks (retry count exhausted)
+	Bytes       int64 // downloaded bytes
+	Duration    time.Duration
+}
+
+// Stats return download statistic (safe for concurrent use)
+func (d *Downloader) Stats() Stats {
+	stats := Stats{
+		Done:        atomic.LoadInt64(&d.counters.done),
+		NotModified: atomic.LoadInt64(&d.counters.notModified),
+		Skipped:     atomic.LoadInt64(&d.counters.skipped),
+		NotFound:    atomic.LoadInt64(&d.counters.notFound),
+		Failed:      atomic.LoadInt64(&d.counters.failed),
+		Bytes:       atomic.LoadInt64(&d.bytes),
+	}
+	d.errsLock.Lock()
+	if !d.startTime.IsZero() {
+		if d.endTime.IsZero() {
+			stats.Duration = time.Since(d.startTime)
+		} else {
+			stats.Duration = d.endTime.Sub(d.startTime)
+		}
+	}
+	d.errsLock.Unlock()
+	return stats
+}
+
+// Progress download progress snapshot
+type Progress struct {
+	Stats
+	Queued  int      // queued tasks (with deferred by host limits)
+	Active  int      // active (not idle) workers
+	Workers []string // current url by worker (blank for idle)
+}
+
+// Progress return download progress (safe for concurrent use)
+func (d *Downloader) Progress() Progress {
+	p := Progress{
+		Stats:  d.Stats(),
+		Queued: d.queue.Size() + int(atomic.LoadInt32(&d.deferred)),
+		Active: int(atomic.LoadInt32(&d.download)),
+	}
+	d.errsLock.Lock()
+	p.Workers = make([]string, len(d.workers))
+	for i := range d.workers {
+		p.Workers[i], _ = d.workers[i].Load().(string)
+	}
+	d.errsLock.Unlock()
+	if p.Active < 0 {
+		p.Active = 0
+	}
+	return p
+}
+
+// taskError set failed flag and save url error
+func (d *Downloader) taskError(task *task, err error) {
+	d.setFailed()
+	d.errsLock.Lock()
+	d.errs = append(d.errs, &URLError{URL: task.url, File: task.fileName, Err: err})
+	d.errsLock.Unlock()
+}
+
+// runError set failed flag and save not url error (first saved)
+func (d *Downloader) runError(err error) {
+	d.setFailed()
+	d.errsLock.Lock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.errsLock.Unlock()
+}
+
+// Errors return url errors (safe for concurrent use)
+func (d *Downloader) Errors() Errors {
+	d.errsLock.Lock()
+	errs := make(Errors, len(d.errs))
+	copy(errs, d.errs)
+	d.errsLock.Unlock()
+	return errs
+}
+
+// Run download with parallel workers (set by SetParallel) and wait for complete.
+// Cancel of ctx abort download (running requests interrupted, map saved).
+// Return ctx error on cancel, first not url error (like map write error), aggregated url errors (Errors) or ErrAborted.
+func (d *Downloader) Run(ctx context.Context) (Stats, error) {
+	if err := d.start(d.parallel); err != nil {
+		return d.Stats(), err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			d.Abort()
+		case <-done:
+		}
+	}()
+	d.Wait()
+	close(done)
+
+	stats := d.Stats()
+	if err := ctx.Err(); err != nil {
+		return stats, err
+	}
+	d.errsLock.Lock()
+	err := d.err
+	d.errsLock.Unlock()
+	if err != nil {
+		return stats, err
+	}
+	if errs := d.Errors(); len(errs) > 0 {
+		return stats, errs
+	}
+	if !d.Running() {
+		return stats, ErrAborted
+	}
+	return stats, nil
+}
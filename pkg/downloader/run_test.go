@@ -0,0 +1,223 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloader_Run(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	// independent downloaders in same process
+	var wg sync.WaitGroup
+	for _, saveMode := range []SaveMode{FlatMode, SiteDirMode} {
+		wg.Add(1)
+		go func(saveMode SaveMode) {
+			defer wg.Done()
+			d := NewDownloader(saveMode, 1, time.Second, 2).SetParallel(2)
+			d.AddRootURL(baseAddr+"/index.html", 3, 0, 0)
+			if _, err := d.NewLoad(tmpdir+"/"+saveMode.String(), "godownloader.map"); err != nil {
+				t.Error(err)
+				return
+			}
+
+			stats, err := d.Run(context.Background())
+
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Errorf("%s: Downloader.Run() error = %v, want Errors", saveMode.String(), err)
+				return
+			}
+			if len(errs) != 1 || errs[0].URL != baseAddr+"/not_found.html" || !errors.Is(errs[0], ErrNotFound) {
+				t.Errorf("%s: Downloader.Run() errors = %v, want not found %s", saveMode.String(), errs, baseAddr+"/not_found.html")
+			}
+			var done int64
+			for kv := range d.processed.Iter() {
+				if kv.Value.(*task).status == TaskOK {
+					done++
+				}
+			}
+			if stats.Done != done || stats.NotFound != 1 || stats.Failed != 0 || stats.Skipped != 0 {
+				t.Errorf("%s: Downloader.Run() stats = %+v, want done %d, not found 1", saveMode.String(), stats, done)
+			}
+			if stats.Bytes == 0 || stats.Duration == 0 {
+				t.Errorf("%s: Downloader.Run() stats = %+v, bytes and duration not set", saveMode.String(), stats)
+			}
+
+			if _, err = d.Run(context.Background()); err != ErrStarted {
+				t.Errorf("%s: Downloader.Run() repeat error = %v, want %v", saveMode.String(), err, ErrStarted)
+			}
+		}(saveMode)
+	}
+	wg.Wait()
+}
+
+func TestDownloader_RunCancel(t *testing.T) {
+	started := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/big.bin" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte("part"))
+		w.(http.Flusher).Flush()
+		close(started)
+		// endless download, interrupted by client
+		<-req.Context().Done()
+	}))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	d := NewDownloader(FlatMode, 1, 0, 2)
+	d.AddRootURL("http://"+ts.Listener.Addr().String()+"/big.bin", 1, 0, 0)
+	if _, err = d.NewLoad(tmpdir+"/out", "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	result := make(chan error)
+	go func() {
+		_, err := d.Run(ctx)
+		result <- err
+	}()
+	select {
+	case err = <-result:
+		if err != context.Canceled {
+			t.Errorf("Downloader.Run() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Downloader.Run() not completed after cancel")
+	}
+}
+
+func TestDownloader_Progress(t *testing.T) {
+	started := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/big.bin" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte("part"))
+		w.(http.Flusher).Flush()
+		close(started)
+		<-req.Context().Done()
+	}))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	url := "http://" + ts.Listener.Addr().String() + "/big.bin"
+	d := NewDownloader(FlatMode, 1, 0, 2)
+	d.AddRootURL(url, 1, 0, 0)
+	if _, err = d.NewLoad(tmpdir+"/out", "godownloader.map"); err != nil {
+		t.Fatal(err)
+	}
+	if p := d.Progress(); p.Queued != 1 || len(p.Workers) != 0 {
+		t.Errorf("Downloader.Progress() before start = %+v, want 1 queued", p)
+	}
+
+	d.Start(2)
+	<-started
+	p := d.Progress()
+	if p.Queued != 0 || p.Active < 1 || len(p.Workers) != 2 {
+		t.Errorf("Downloader.Progress() = %+v, want active of 2 workers", p)
+	} else if (p.Workers[0] == url) == (p.Workers[1] == url) {
+		t.Errorf("Downloader.Progress() workers = %v, want one with %s", p.Workers, url)
+	}
+	d.Abort()
+	d.Wait()
+	if p = d.Progress(); p.Active != 0 || p.Workers[0] != "" || p.Workers[1] != "" {
+		t.Errorf("Downloader.Progress() after stop = %+v, want no active workers", p)
+	}
+}
+
+// slowHandler delay response for path
+func slowHandler(path string, delay time.Duration) http.Handler {
+	h := testHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == path {
+			time.Sleep(delay)
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// workers must not exit, while root task (or task, deferred by host limits) in flight
+func TestDownloader_Run_noEarlyExit(t *testing.T) {
+	ts := httptest.NewServer(slowHandler("/index.html", 300*time.Millisecond))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	baseAddr := "http://" + ts.Listener.Addr().String()
+
+	tests := []struct {
+		name   string
+		limits HostLimits
+	}{
+		{"slow root", HostLimits{}},
+		{"slow root with conns limit", HostLimits{MaxConns: 1}},
+		{"slow root with rate limit", HostLimits{Rate: 20}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(FlatMode, 1, time.Second, 2).SetParallel(4).SetHostLimits(tt.limits)
+			d.AddRootURL(baseAddr+"/index.html", 3, 0, 0)
+			if _, err := d.NewLoad(tmpdir+"/"+strconv.Itoa(i), "godownloader.map"); err != nil {
+				t.Fatal(err)
+			}
+
+			stats, _ := d.Run(context.Background())
+
+			for _, url := range []string{"/index.html", "/link1.html", "/link2.html", "/style.css", "/1.gif", "/1.gz"} {
+				if task := d.taskByURL(baseAddr + url); task == nil || task.status != TaskOK {
+					t.Errorf("Downloader.Run() %s not downloaded", url)
+				}
+			}
+			if stats.NotFound != 1 {
+				t.Errorf("Downloader.Run() stats = %+v, want not found 1", stats)
+			}
+			if n := d.queue.Size(); n != 0 {
+				t.Errorf("Downloader.queue.Size() = %d after Run, want 0", n)
+			}
+			if n := atomic.LoadInt32(&d.deferred); n != 0 {
+				t.Errorf("Downloader deferred = %d after Run, want 0", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package downloader
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// isPage check for task is page (root url or link from a or iframe), not page requisite (like css, js or image)
+func (task *task) isPage() bool {
+	switch task.tag {
+	case "", "a", "iframe":
+		return true
+	}
+	return false
+}
+
+// schedItem queued task with priority
+type schedItem struct {
+	task      *task
+	requisite bool   // page requisite (scheduled before pages)
+	links     int32  // remaining links level (pages with greater level scheduled first)
+	seq       uint64 // queue order for equal priority
+	host      *hostQueue
+	index     int // index in host heap
+}
+
+func (a *schedItem) less(b *schedItem) bool {
+	if a.requisite != b.requisite {
+		return a.requisite
+	}
+	if a.links != b.links {
+		return a.links > b.links
+	}
+	return a.seq < b.seq
+}
+
+// taskHeap priority queue (container/heap)
+type taskHeap []*schedItem
+
+func (h taskHeap) Len() int           { return len(h) }
+func (h taskHeap) Less(i, j int) bool { return h[i].less(h[j]) }
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	item := x.(*schedItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[0 : n-1]
+	return item
+}
+
+// hostQueue queued tasks for host (or for all hosts without round-robin)
+type hostQueue struct {
+	host  string
+	items taskHeap
+}
+
+// scheduler task queue with priority classes: page requisites first, then pages by remaining links level (BFS order).
+// With round-robin hosts are served in turn (priority is per host).
+// Task queued once, task, requeued while running (for retry or recheck), queued again after Done.
+// Get wait for task, while any task queued, running or deferred (in flight), so workers stop exactly when all done.
+type scheduler struct {
+	lock       sync.Mutex
+	cond       *sync.Cond // signaled on new queued task, broadcasted on all done or close
+	closed     bool
+	roundRobin bool
+	hosts      map[string]*hostQueue
+	ring       []*hostQueue // hosts with queued tasks (in round-robin order)
+	next       int          // next host in ring
+	queued     map[*task]*schedItem
+	running    map[*task]bool // running tasks (true, if requeued while running)
+	deferred   map[*task]bool // tasks, deferred outside of scheduler (by host limits) until Put
+	seq        uint64
+	size       int
+}
+
+func newScheduler() *scheduler {
+	s := &scheduler{
+		hosts:    make(map[string]*hostQueue),
+		queued:   make(map[*task]*schedItem),
+		running:  make(map[*task]bool),
+		deferred: make(map[*task]bool),
+	}
+	s.cond = sync.NewCond(&s.lock)
+	return s
+}
+
+// SetRoundRobin enable per host round-robin (already queued tasks rescheduled)
+func (s *scheduler) SetRoundRobin(roundRobin bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.roundRobin == roundRobin {
+		return
+	}
+	s.roundRobin = roundRobin
+	items := make([]*schedItem, 0, s.size)
+	for _, h := range s.ring {
+		items = append(items, h.items...)
+	}
+	// keep hosts order by queued order
+	sort.Slice(items, func(i, j int) bool { return items[i].seq < items[j].seq })
+	s.hosts = make(map[string]*hostQueue)
+	s.ring = nil
+	s.next = 0
+	s.size = 0
+	for _, item := range items {
+		s._pushItem(item)
+	}
+}
+
+// Put queue task (or update priority for queued task)
+func (s *scheduler) Put(task *task) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.deferred, task)
+	if _, ok := s.running[task]; ok {
+		s.running[task] = true
+		return
+	}
+	if item, ok := s.queued[task]; ok {
+		item.requisite = !task.isPage()
+		item.links = task.Links()
+		heap.Fix(&item.host.items, item.index)
+		return
+	}
+	s._push(task)
+}
+
+// Get wait for task with max priority (task must be released with Done),
+// return false if closed or no tasks in flight (all done)
+func (s *scheduler) Get() (*task, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for s.size == 0 && !s.closed && !s._idle() {
+		s.cond.Wait()
+	}
+	if s.closed || s.size == 0 {
+		return nil, false
+	}
+	return s._get(), true
+}
+
+// TryGet get task with max priority without wait (task must be released with Done)
+func (s *scheduler) TryGet() (*task, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.size == 0 {
+		return nil, false
+	}
+	return s._get(), true
+}
+
+// internal method, need lock before
+func (s *scheduler) _get() *task {
+	h := s.ring[s.next]
+	item := heap.Pop(&h.items).(*schedItem)
+	if len(h.items) == 0 {
+		// remove host from ring, next host shifted to current position
+		s.ring = append(s.ring[:s.next], s.ring[s.next+1:]...)
+		delete(s.hosts, h.host)
+	} else if s.roundRobin {
+		s.next++
+	}
+	if s.next >= len(s.ring) {
+		s.next = 0
+	}
+	delete(s.queued, item.task)
+	s.running[item.task] = false
+	s.size--
+	return item.task
+}
+
+// Done release task, got by Get (and queue it again, if requeued while running)
+func (s *scheduler) Done(task *task) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	requeue := s.running[task]
+	delete(s.running, task)
+	if requeue {
+		s._push(task)
+	} else if s.size == 0 && s._idle() {
+		// all done, wakeup waiting workers for exit
+		s.cond.Broadcast()
+	}
+}
+
+// Defer mark task as deferred outside of scheduler (task in flight until Put)
+func (s *scheduler) Defer(task *task) {
+	s.lock.Lock()
+	s.deferred[task] = true
+	s.lock.Unlock()
+}
+
+// Close wakeup waiting workers and stop return tasks (on abort)
+func (s *scheduler) Close() {
+	s.lock.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+// internal method, need lock before
+func (s *scheduler) _idle() bool {
+	return len(s.running) == 0 && len(s.deferred) == 0
+}
+
+// Size return queued tasks count
+func (s *scheduler) Size() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.size
+}
+
+// internal method, need lock before
+func (s *scheduler) _push(task *task) {
+	s.seq++
+	s._pushItem(&schedItem{task: task, requisite: !task.isPage(), links: task.Links(), seq: s.seq})
+}
+
+// internal method, need lock before
+func (s *scheduler) _pushItem(item *schedItem) {
+	var host string
+	if s.roundRobin {
+		host = urlHost(item.task.url)
+	}
+	h, ok := s.hosts[host]
+	if !ok {
+		h = &hostQueue{host: host}
+		s.hosts[host] = h
+		s.ring = append(s.ring, h)
+	}
+	item.host = h
+	heap.Push(&h.items, item)
+	s.queued[item.task] = item
+	s.size++
+	s.cond.Signal()
+}
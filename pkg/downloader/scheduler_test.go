@@ -0,0 +1,196 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func newSchedTask(url string, tag string, links int32) *task {
+	t := newLoadTask(url, "/", links, 0, 0, 1)
+	t.tag = tag
+	return t
+}
+
+func verifySchedOrder(t *testing.T, s *scheduler, want []string) {
+	got := make([]string, 0, len(want))
+	for {
+		task, ok := s.Get()
+		if !ok {
+			break
+		}
+		s.Done(task)
+		got = append(got, task.url)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("scheduler order = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("scheduler order = %v, want %v", got, want)
+		}
+	}
+	if s.Size() != 0 {
+		t.Errorf("scheduler.Size() = %d, want 0", s.Size())
+	}
+}
+
+func Test_scheduler_priority(t *testing.T) {
+	s := newScheduler()
+	for _, task := range []*task{
+		newSchedTask("http://test.int/", "", 3),
+		newSchedTask("http://test.int/2/link.html", "a", 1),
+		newSchedTask("http://test.int/1/link.html", "a", 2),
+		newSchedTask("http://test.int/1/1.gif", "img", 2),
+		newSchedTask("http://test.int/2/link2.html", "a", 1),
+		newSchedTask("http://test.int/2/style.css", "link", 1),
+		newSchedTask("http://test.int/frame.html", "iframe", 2),
+	} {
+		s.Put(task)
+	}
+	if s.Size() != 7 {
+		t.Fatalf("scheduler.Size() = %d, want 7", s.Size())
+	}
+	verifySchedOrder(t, s, []string{
+		// requisites
+		"http://test.int/1/1.gif",
+		"http://test.int/2/style.css",
+		// pages by level (BFS) in queued order
+		"http://test.int/",
+		"http://test.int/1/link.html",
+		"http://test.int/frame.html",
+		"http://test.int/2/link.html",
+		"http://test.int/2/link2.html",
+	})
+}
+
+func Test_scheduler_requeue(t *testing.T) {
+	s := newScheduler()
+	t1 := newSchedTask("http://test.int/1.html", "a", 1)
+	t2 := newSchedTask("http://test.int/2.html", "a", 1)
+	s.Put(t1)
+	s.Put(t2)
+	// queued once
+	s.Put(t1)
+	if s.Size() != 2 {
+		t.Fatalf("scheduler.Size() = %d, want 2", s.Size())
+	}
+
+	// priority updated for queued task
+	t2.UpdateLinks(2, 0, 0)
+	s.Put(t2)
+	task, ok := s.TryGet()
+	if !ok || task != t2 {
+		t.Fatalf("scheduler.TryGet() = %v, want %s", task, t2.url)
+	}
+
+	// requeued while running, not returned before Done
+	s.Put(t2)
+	if task, ok = s.TryGet(); !ok || task != t1 {
+		t.Fatalf("scheduler.TryGet() = %v, want %s", task, t1.url)
+	}
+	if task, ok = s.TryGet(); ok {
+		t.Fatalf("scheduler.TryGet() = %s for running task, want none", task.url)
+	}
+	s.Done(t1)
+	if task, ok = s.TryGet(); ok {
+		t.Fatalf("scheduler.TryGet() = %s after done without requeue, want none", task.url)
+	}
+	s.Done(t2)
+	verifySchedOrder(t, s, []string{t2.url})
+}
+
+func Test_scheduler_roundRobin(t *testing.T) {
+	s := newScheduler()
+	for _, task := range []*task{
+		newSchedTask("http://a.int/", "", 2),
+		newSchedTask("http://a.int/1.html", "a", 1),
+		newSchedTask("http://a.int/2.html", "a", 1),
+		newSchedTask("http://b.int/", "", 2),
+		newSchedTask("http://b.int/1.gif", "img", 1),
+		newSchedTask("http://c.int/", "", 2),
+	} {
+		s.Put(task)
+	}
+	// already queued tasks rescheduled
+	s.SetRoundRobin(true)
+	verifySchedOrder(t, s, []string{
+		"http://a.int/",
+		"http://b.int/1.gif",
+		"http://c.int/",
+		"http://a.int/1.html",
+		"http://b.int/",
+		"http://a.int/2.html",
+	})
+}
+
+// schedGet run blocking Get in goroutine
+func schedGet(s *scheduler) chan *task {
+	ch := make(chan *task, 1)
+	go func() {
+		task, _ := s.Get()
+		ch <- task
+	}()
+	return ch
+}
+
+func verifySchedWait(t *testing.T, ch chan *task, reason string) {
+	select {
+	case task := <-ch:
+		t.Fatalf("scheduler.Get() = %v while %s, want wait", task, reason)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func verifySchedGet(t *testing.T, ch chan *task, want *task) {
+	select {
+	case task := <-ch:
+		if task != want {
+			t.Fatalf("scheduler.Get() = %v, want %v", task, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scheduler.Get() not returned")
+	}
+}
+
+func Test_scheduler_wait(t *testing.T) {
+	s := newScheduler()
+	t1 := newSchedTask("http://test.int/", "", 1)
+	t2 := newSchedTask("http://test.int/1.html", "a", 0)
+
+	// nothing in flight
+	verifySchedGet(t, schedGet(s), nil)
+
+	s.Put(t1)
+	verifySchedGet(t, schedGet(s), t1)
+
+	// wait while task running, wakeup on new task
+	ch := schedGet(s)
+	verifySchedWait(t, ch, "task running")
+	s.Put(t2)
+	verifySchedGet(t, ch, t2)
+	s.Done(t2)
+
+	// wait while task deferred
+	s.Defer(t2)
+	s.Done(t1)
+	ch = schedGet(s)
+	verifySchedWait(t, ch, "task deferred")
+	s.Put(t2)
+	verifySchedGet(t, ch, t2)
+
+	// exit on all done
+	ch = schedGet(s)
+	verifySchedWait(t, ch, "task running")
+	s.Done(t2)
+	verifySchedGet(t, ch, nil)
+
+	// exit on close
+	s.Put(t1)
+	if task, ok := s.TryGet(); !ok || task != t1 {
+		t.Fatalf("scheduler.TryGet() = %v, want %s", task, t1.url)
+	}
+	ch = schedGet(s)
+	verifySchedWait(t, ch, "task running")
+	s.Close()
+	verifySchedGet(t, ch, nil)
+}
@@ -1,8 +1,8 @@
 package downloader
 
 import (
-	"bufio"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
 	"path"
@@ -10,13 +10,13 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/msaf1980/godownloader/pkg/fileutils"
 	"github.com/msaf1980/godownloader/pkg/strutils"
 	"github.com/msaf1980/godownloader/pkg/urlutils"
 
 	"github.com/goware/urlx"
-	"github.com/rs/zerolog/log"
 )
 
 // Protocol
@@ -44,30 +44,73 @@ func URLProtocol(url string) Protocol {
 	return Unsuppoted
 }
 
+// TaskStatus task state
+type TaskStatus int8
+
+const (
+	// TaskNew task not started or not completed
+	TaskNew TaskStatus = iota
+	// TaskOK task completed
+	TaskOK
+	// TaskFailed task failed (retry count exhausted)
+	TaskFailed
+	// TaskNotFound url not found
+	TaskNotFound
+	// TaskSkipped task skipped by quotas
+	TaskSkipped
+	// TaskSkippedLevel url skipped by level (not a task, recorded for report)
+	TaskSkippedLevel
+	// TaskSkippedFilter url skipped by filters or robots.txt (not a task, recorded for report)
+	TaskSkippedFilter
+)
+
+var (
+	taskStatusMap = map[string]TaskStatus{"new": TaskNew, "ok": TaskOK, "failed": TaskFailed, "not_found": TaskNotFound, "skipped": TaskSkipped,
+		"skipped_level": TaskSkippedLevel, "skipped_filter": TaskSkippedFilter}
+	taskStatusStr = []string{"new", "ok", "failed", "not_found", "skipped", "skipped_level", "skipped_filter"}
+)
+
+func (s *TaskStatus) Set(value string) error {
+	status, ok := taskStatusMap[strings.ToLower(value)]
+	if ok {
+		*s = status
+		return nil
+	}
+	return fmt.Errorf("unknown task status: '%s'", value)
+}
+
+func (s TaskStatus) String() string {
+	return taskStatusStr[s]
+}
+
 type task struct {
 	url       string
 	rootDir   string
+	root      string // root url (for filters)
+	referrer  string // url of page, where link first found
+	tag       string // element name (or style, css), where link first found
+	attr      string // attribute name, where link first found (blank for css)
 	protocol  Protocol
 	links     int32 // download links (from same site on same or upper dir)
 	downLevel int32 // download links (from same sites underlying directories)
 	extLinks  int32 // download links (from external sites)
 
-	fileName    string // relative filename (blank if no try downloads else)
-	contentType string
-	success     bool
-	size        int64 // size from header
-	try         int   // retry count - stop on 0 or success
+	fileName     string // relative filename (blank if no try downloads else)
+	contentType  string
+	status       TaskStatus
+	size         int64 // size from header
+	try          int   // retry count - stop on 0 or success
+	etag         string
+	lastModified string
+	httpStatus   int           // last response http status
+	attempts     int           // download attempts
+	duration     time.Duration // download attempts duration
+	created      time.Time
+	updated      time.Time // last map store time
 
-	lock      uint32     // atomic set 1 for hold task during download/parse (TryLock) and relase when done (Unlock)
 	lockLevel sync.Mutex // set 1 for hold task during level
-}
-
-func (task *task) TryLock() bool {
-	return atomic.CompareAndSwapUint32(&task.lock, 0, 1)
-}
-
-func (task *task) UnLock() {
-	atomic.CompareAndSwapUint32(&task.lock, 1, 0)
+	recheck   uint32     // atomic set 1 when levels changed after task success (need reparse)
+	refreshed uint32     // atomic set 1 when task refreshed in update mode
 }
 
 func (task *task) UpdateLinks(links int32, downLevel int32, extLinks int32) bool {
@@ -85,10 +128,33 @@ func (task *task) UpdateLinks(links int32, downLevel int32, extLinks int32) bool
 		atomic.StoreInt32(&task.extLinks, extLinks)
 		changed = true
 	}
+	if changed {
+		atomic.StoreUint32(&task.recheck, 1)
+	}
 	task.lockLevel.Unlock()
 	return changed
 }
 
+// NeedRecheck check if levels changed after task success
+func (task *task) NeedRecheck() bool {
+	return atomic.LoadUint32(&task.recheck) == 1
+}
+
+// ResetRecheck reset recheck flag and return previous state
+func (task *task) ResetRecheck() bool {
+	return atomic.SwapUint32(&task.recheck, 0) == 1
+}
+
+// TryRefresh set refreshed flag, return false if task already refreshed
+func (task *task) TryRefresh() bool {
+	return atomic.CompareAndSwapUint32(&task.refreshed, 0, 1)
+}
+
+// Refreshed check if task already refreshed
+func (task *task) Refreshed() bool {
+	return atomic.LoadUint32(&task.refreshed) == 1
+}
+
 func (task *task) Links() int32 {
 	return atomic.LoadInt32(&task.links)
 }
@@ -105,7 +171,8 @@ func (task *task) ExtLinks() int32 {
 func newLoadTask(url, rootDir string, links int32, downLevel int32, extLinks int32, retry int) *task {
 	return &task{url: url, rootDir: rootDir, links: links, downLevel: downLevel, extLinks: extLinks,
 		protocol: URLProtocol(url),
-		success:  false, try: retry,
+		status:   TaskNew, try: retry,
+		created: time.Now(),
 	}
 }
 
@@ -131,72 +198,18 @@ func (d *Downloader) taskByFileName(fileName string) *task {
 // }
 
 func (d *Downloader) addTask(t *task) (*task, bool) {
-	p, exist := d.processed.GetOrInsert(t.url, t)
+	p, exist := d.processed.GetOrInsert(d.canonicalizer.Key(t.url), t)
 	return p.(*task), exist
 }
 
 func (d *Downloader) taskByURL(url string) *task {
-	t, ok := d.processed.Get(url)
+	t, ok := d.processed.Get(d.canonicalizer.Key(url))
 	if ok {
 		return t.(*task)
 	}
 	return nil
 }
 
-func (d *Downloader) newMap() (err error) {
-	if d.fMap != nil {
-		return fmt.Errorf("map already open")
-	}
-	d.fMap, err = os.OpenFile(d.fileMap, os.O_CREATE|os.O_RDWR, 0o644)
-	return
-}
-
-func (d *Downloader) openMap() (err error) {
-	if d.fMap != nil {
-		return fmt.Errorf("map already open")
-	}
-	d.fMap, err = os.OpenFile(d.fileMap, os.O_RDWR, 0o644)
-	scanner := bufio.NewScanner(d.fMap)
-	var t *task
-	for scanner.Scan() {
-		line := scanner.Text()
-		if t == nil {
-			t = &task{url: line}
-		} else {
-			s := strings.Split(line, " ")
-			if len(s) != 2 {
-				return fmt.Errorf("map fileName/contentType line incomplete: %s", line)
-			}
-			t.fileName = s[0]
-			t.contentType = s[1]
-			task, exist := d.addTask(t)
-			if exist {
-				task.fileName = t.fileName
-				task.contentType = t.contentType
-				task.UpdateLinks(t.Links(), t.DownLevel(), t.ExtLinks())
-			}
-			t = nil
-		}
-	}
-	return
-}
-
-func (d *Downloader) closeMap() error {
-	if d.fMap == nil {
-		return nil
-	}
-	return d.fMap.Close()
-}
-
-// internal method, during filename generate
-func (d *Downloader) _storeMap(task *task) error {
-	_, err := d.fMap.Write([]byte(task.url + "\n" + task.fileName + " " + task.contentType + "\n"))
-	if err != nil {
-		d.Abort()
-	}
-	return err
-}
-
 // internal method, need lock filesLock before
 func (d *Downloader) _inrTaskFileName(name string, ext string) (string, error) {
 	i := int64(1)
@@ -255,7 +268,7 @@ func (d *Downloader) _genTaskFileName(task *task) error {
 
 		if d.saveMode == FlatDirMode {
 			var dir string
-			p, _ = appendFlatDir(p, task.contentType)
+			p, dir = appendFlatDir(p, task.contentType)
 			err = mkdir(d.outdir + "/" + dir)
 			if err != nil {
 				return err
@@ -311,68 +324,160 @@ func (d *Downloader) _genTaskFileName(task *task) error {
 	return fmt.Errorf("not realized")
 }
 
+// recheckTask reparse already downloaded html or css file (for load links after change levels)
 func (d *Downloader) recheckTask(task *task) bool {
-	// TODO: reparse files for load after change levels
-
-	if !d.failed {
-		d.failed = true
+	task.ResetRecheck()
+	var err error
+	if d.check {
+		// no saved file in check mode, request again
+		err = d.httpAttempt(task)
+	} else {
+		var data []byte
+		data, err = ioutil.ReadFile(d.outdir + "/" + task.fileName)
+		if err == nil {
+			if task.contentType == "text/css" {
+				err = d.cssSave(data, task, false, d.loadRef(task))
+			} else {
+				err = d.htmlParse(data, task, false)
+			}
+		}
 	}
-	log.Error().Str("url", task.url).Str("file", task.fileName).Msg("recheck not realized at now")
-	return false
+	if err != nil {
+		d.taskError(task, err)
+		d.observer.TaskFailed(task.info(), err)
+		d.logger.Error().Str("url", task.url).Str("file", task.fileName).Msg(err.Error())
+		return false
+	}
+	d.logger.Info().Str("url", task.url).Str("file", task.fileName).Msg("rechecked")
+	return true
 }
 
 func (d *Downloader) runTask(task *task) bool {
 	// Check if file exist (continue download)
-	if !task.success && len(task.fileName) > 0 {
+	if task.status != TaskOK && len(task.fileName) > 0 {
 		if s, err := os.Stat(d.outdir + "/" + task.fileName); err == nil {
 			if s.IsDir() {
-				log.Error().Str("url", task.url).Str("file", task.fileName).Msg("must be a file")
+				d.logger.Error().Str("url", task.url).Str("file", task.fileName).Msg("must be a file")
 				return false
 			}
-			task.success = true
+			task.status = TaskOK
 		} else if !os.IsNotExist(err) {
-			log.Error().Str("url", task.url).Str("file", task.fileName).Msg(err.Error())
+			d.logger.Error().Str("url", task.url).Str("file", task.fileName).Msg(err.Error())
 			return false
 		}
 	}
 
-	if task.success {
+	if task.status == TaskOK {
+		if d.needRefresh(task) && task.TryRefresh() {
+			// update mode, conditional request
+			d.observer.TaskStarted(task.info())
+			err := d.httpAttempt(task)
+			if err == nil {
+				atomic.AddInt64(&d.counters.done, 1)
+				d.observer.TaskSaved(task.info())
+				d.logger.Info().Str("url", task.url).Str("file", task.fileName).Int64("size", task.size).Msg("updated")
+				return d.storeMap(task) == nil
+			} else if isQuotaError(err) {
+				atomic.AddInt64(&d.counters.skipped, 1)
+				d.observer.TaskSkipped(task.info(), err.Error())
+				d.logger.Info().Str("url", task.url).Str("file", task.fileName).Str("reason", err.Error()).Msg("update skipped")
+				return false
+			} else if !d.Running() {
+				d.logger.Info().Str("url", task.url).Str("file", task.fileName).Msg("update aborted")
+				return false
+			} else if err != errNotModified {
+				atomic.AddInt64(&d.counters.failed, 1)
+				d.taskError(task, err)
+				d.observer.TaskFailed(task.info(), err)
+				d.logger.Error().Str("url", task.url).Str("file", task.fileName).Msg(err.Error())
+				d.storeMap(task)
+				return false
+			}
+			atomic.AddInt64(&d.counters.notModified, 1)
+			d.logger.Debug().Str("url", task.url).Str("file", task.fileName).Msg("not modified")
+		}
 		// already doanload, reload and check
-		if task.protocol == HTTP && task.contentType == "text/html" {
+		if task.protocol == HTTP && (task.contentType == "text/html" || task.contentType == "text/css") {
 			return d.recheckTask(task)
 		}
 		return true
 	} else if task.try > 0 {
 		var err error
+		d.observer.TaskStarted(task.info())
 		switch task.protocol {
 		case HTTP:
-			err = d.httpLoad(task)
+			err = d.httpAttempt(task)
 			// if err == nil && task.contentType == "text/html" {
 			// 	return d.recheckTask(task)
 			// }
 		default:
 			task.try = 0
-			log.Warn().Str("url", task.url).Str("file", task.fileName).Msg("protocol not supported")
+			task.status = TaskFailed
+			atomic.AddInt64(&d.counters.failed, 1)
+			d.observer.TaskFailed(task.info(), fmt.Errorf("protocol not supported"))
+			d.logger.Warn().Str("url", task.url).Str("file", task.fileName).Msg("protocol not supported")
+			d.storeMap(task)
 			return false
 		}
 		if err != nil {
+			if isQuotaError(err) {
+				// quota exceeded, not a failure
+				task.try = 0
+				task.status = TaskSkipped
+				atomic.AddInt64(&d.counters.skipped, 1)
+				d.observer.TaskSkipped(task.info(), err.Error())
+				d.logger.Info().Str("url", task.url).Str("file", task.fileName).Str("reason", err.Error()).Msg("skipped")
+				d.storeMap(task)
+				return false
+			}
+			if !d.Running() {
+				// interrupted by abort, not a failure (and partial file can be resumed)
+				d.logger.Info().Str("url", task.url).Str("file", task.fileName).Msg("aborted")
+				d.storeMap(task)
+				return false
+			}
 			if task.try > 1 {
 				task.try--
 				// requeue task
 				d.queue.Put(task)
+				d.setFailed()
+			} else {
+				if task.status == TaskNotFound {
+					atomic.AddInt64(&d.counters.notFound, 1)
+				} else {
+					task.try = 0
+					task.status = TaskFailed
+					atomic.AddInt64(&d.counters.failed, 1)
+				}
+				d.taskError(task, err)
 			}
-			if !d.failed {
-				d.failed = true
-			}
-			log.Error().Str("url", task.url).Str("file", task.fileName).Msg(err.Error())
+			d.observer.TaskFailed(task.info(), err)
+			d.logger.Error().Str("url", task.url).Str("file", task.fileName).Msg(err.Error())
+			d.storeMap(task)
 			return false
 		}
-		log.Info().Str("url", task.url).Str("file", task.fileName).Int64("size", task.size).Msg("done")
-		return true
+		atomic.AddInt64(&d.counters.done, 1)
+		d.observer.TaskSaved(task.info())
+		d.logger.Info().Str("url", task.url).Str("file", task.fileName).Int64("size", task.size).Msg("done")
+		return d.storeMap(task) == nil
 	}
 	return false
 }
 
+// httpAttempt load task with http and count attempts and duration
+func (d *Downloader) httpAttempt(task *task) error {
+	start := time.Now()
+	task.attempts++
+	err := d.httpLoad(task)
+	task.duration += time.Since(start)
+	return err
+}
+
+// needRefresh check if task need conditional request in update mode
+func (d *Downloader) needRefresh(task *task) bool {
+	return d.update && task.protocol == HTTP && !task.Refreshed()
+}
+
 func level(url, baseHost, baseDir string, links, downLevel, extLinks int32) (int32, int32, int32) {
 	if links == 0 {
 		return 0, 0, 0
@@ -409,9 +514,11 @@ func (d *Downloader) AddRootURL(url string, level int32, downLevel int32, extLev
 	if level < 1 {
 		return false
 	}
+	url = d.canonicalizer.Canonical(url)
 	_, p := urlutils.SplitURL(url)
 	dir := urlutils.BaseURLDir(p)
 	task := newLoadTask(url, dir, level, downLevel, extLevel, d.retry)
+	task.root = url
 	//d.processLock.Lock()
 	_, exist := d.addTask(task)
 	if exist {
@@ -421,38 +528,72 @@ func (d *Downloader) AddRootURL(url string, level int32, downLevel int32, extLev
 		//d.processLock.Unlock()
 		//d.root.PushBack(task)
 		d.queue.Put(task)
+		d.observer.TaskQueued(task.info())
 	}
 
 	return true
 }
 
 func (d *Downloader) addURL(url string, pageContent bool, retry int,
-	baseHost string, baseDir string,
+	baseHost string, baseDir string, root string, src linkSource,
 	baseLinks int32, baseDownLevel int32, baseExtLinks int32) bool {
 
-	stripURL := urlutils.StripAnchor(url)
+	stripURL := d.canonicalizer.Canonical(url)
 	links, downLevel, extLinks := level(stripURL, baseHost, baseDir, baseLinks, baseDownLevel, baseExtLinks)
+	d.addEdge(src, stripURL, links)
 	queued := false
 	exist := true
-	if !pageContent {
-		if links < 1 {
-			return false
-		}
+	if !pageContent && links < 1 && !d.check {
+		d.skipURL(stripURL, root, src, TaskSkippedLevel, "links level exhausted")
+		return false
+	}
+	if !d.urlAccepted(stripURL, root) {
+		d.logger.Debug().Str("url", stripURL).Str("root", root).Msg("rejected by filters")
+		d.skipURL(stripURL, root, src, TaskSkippedFilter, "rejected by filters")
+		return false
+	}
+	if !d.robotsAllowed(stripURL) {
+		d.logger.Debug().Str("url", stripURL).Msg("disallowed by robots.txt")
+		d.skipURL(stripURL, root, src, TaskSkippedFilter, "disallowed by robots.txt")
+		return false
 	}
 
+	var info TaskInfo
 	t := d.taskByURL(stripURL)
 	if t == nil {
 		t = newLoadTask(stripURL, baseDir, links, downLevel, extLinks, d.retry)
+		t.root = root
+		t.setSource(src)
 		t, exist = d.addTask(t) // recheck, may be added by concurrent
 		if !exist {
 			queued = true
+			d.storeMap(t)
+			info = t.info()
 		}
 	}
 	if exist {
 		queued = t.UpdateLinks(links, downLevel, extLinks)
+		// task may be running
+		info = t.requeueInfo()
 	}
 	if queued {
 		d.queue.Put(t)
+		d.observer.TaskQueued(info)
 	}
 	return true
 }
+
+// skipURL record url, skipped by level or filters, in map (for report)
+func (d *Downloader) skipURL(url string, root string, src linkSource, status TaskStatus, reason string) {
+	if d.taskByURL(url) != nil {
+		return
+	}
+	t := newLoadTask(url, "", 0, 0, 0, 0)
+	t.root = root
+	t.setSource(src)
+	t.status = status
+	if _, exist := d.skipped.GetOrInsert(d.canonicalizer.Key(url), t); !exist {
+		d.storeMap(t)
+		d.observer.TaskSkipped(t.info(), reason)
+	}
+}
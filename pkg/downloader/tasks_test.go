@@ -1,101 +1,18 @@
 package downloader
 
 import (
+	"bytes"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"testing"
 	"time"
 
 	"github.com/msaf1980/godownloader/pkg/urlutils"
 )
 
-func Test_task_TryLock(t *testing.T) {
-	task := newLoadTask("", "/", 0, 0, 0, 0)
-	if !task.TryLock() {
-		t.Fatalf("task.TryLock() can't lock")
-
-	}
-	if task.TryLock() {
-		t.Fatalf("task.TryLock() lock already locked")
-	}
-}
-
-func TestDownloader_Map(t *testing.T) {
-	var err error
-	d := NewDownloader(FlatMode, 1, time.Second, 1)
-	d.fMap, err = ioutil.TempFile("", "godownloader")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer func() {
-		d.closeMap()
-		os.Remove(d.fMap.Name())
-	}()
-
-	tests := []*task{
-		{url: "http://test.int/index.html", fileName: "index.html", contentType: "text/html"},
-		{url: "http://test.int/link1.html", fileName: "link1.html", contentType: "text/html"},
-		{url: "http://test.int/1.gif", fileName: "1.gif", contentType: "image/gif"},
-	}
-	for _, tt := range tests {
-		t.Run(tt.url, func(t *testing.T) {
-			err = d._storeMap(tt)
-			if err != nil {
-				t.Fatalf("Downloader._storeMap() error = %v", err)
-			}
-		})
-	}
-
-	// Verify
-	dv := NewDownloader(FlatMode, 1, time.Second, 1)
-
-	dv.AddRootURL("http://test.int/index.html", 1, 0, 0)
-	// Sync test task links
-	tests[0].links = 1
-
-	dv.fileMap = d.fMap.Name()
-	err = dv.openMap()
-	if err != nil {
-		t.Fatal(err)
-	}
-	err = dv.closeMap()
-	if err != nil {
-		t.Error(err)
-	}
-	if dv.processed.Len() != len(tests) {
-		t.Errorf("map length = %d, want %d", dv.processed.Len(), len(tests))
-	}
-	for _, task := range tests {
-		if lTask := dv.taskByURL(task.url); lTask == nil {
-			t.Errorf("map url %s not found", task.url)
-		} else {
-			if lTask.fileName != task.fileName {
-				t.Errorf("map url %s fileName  = '%s', want '%s'", task.url, lTask.fileName, task.fileName)
-			}
-			if lTask.fileName != task.fileName {
-				t.Errorf("map url %s contentType  = '%s', want '%s'", task.url, lTask.contentType, task.contentType)
-			}
-			links := task.Links()
-			lLinks := lTask.Links()
-			downLevel := task.DownLevel()
-			lDownLevel := lTask.DownLevel()
-			extLinks := task.ExtLinks()
-			lExtLinks := lTask.ExtLinks()
-			if links != lLinks {
-				t.Errorf("map url %s links  = %d, want %d", task.url, lLinks, links)
-			}
-			if downLevel != lDownLevel {
-				t.Errorf("map url %s downLevel  = %d, want %d", task.url, lDownLevel, downLevel)
-			}
-			if extLinks != lExtLinks {
-				t.Errorf("map url %s extLinks  = %d, want %d", task.url, lExtLinks, extLinks)
-			}
-		}
-
-	}
-}
-
 func Test_genTaskFileName_FlatMode(t *testing.T) {
 	var err error
 	saveMode := FlatMode
@@ -231,6 +148,12 @@ func Test_genTaskFileName_FlatDirMode(t *testing.T) {
 			if task.fileName != tt.want {
 				t.Errorf("taskGenerateFilename() = %v, want %v", task.fileName, tt.want)
 			}
+			// content type dir created
+			if dir := path.Dir(tt.want); dir != "." {
+				if stat, err := os.Stat(d.outdir + "/" + dir); err != nil || !stat.IsDir() {
+					t.Errorf("taskGenerateFilename() dir %s not created", dir)
+				}
+			}
 		})
 	}
 }
@@ -513,6 +436,43 @@ func TestDownloader_addTask(t *testing.T) {
 	}
 }
 
+func TestDownloader_addURLCanonical(t *testing.T) {
+	d := NewDownloader(FlatMode, 1, time.Second, 1).
+		SetIgnoreRobots(true).
+		SetCanonicalizer(urlutils.Canonicalizer{SortQuery: true, StripParams: []string{"utm_*"}, IgnoreScheme: true})
+	if !d.AddRootURL("HTTP://Test.int:80", 2, 0, 0) {
+		t.Fatal("Downloader.AddRootURL() failed")
+	}
+
+	tests := []struct {
+		url     string
+		wantURL string
+		wantLen int
+	}{
+		{"http://test.int/", "http://test.int/", 1},
+		{"http://test.int/a?b=1&a=2", "http://test.int/a?a=2&b=1", 2},
+		{"http://TEST.int:80/a?a=2&b=1#top", "http://test.int/a?a=2&b=1", 2},
+		{"http://test.int/a?utm_source=x&b=1&a=2", "http://test.int/a?a=2&b=1", 2},
+		{"https://test.int/a?a=2&b=1", "http://test.int/a?a=2&b=1", 2},
+		{"https://test.int/b", "https://test.int/b", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			d.addURL(tt.url, true, 1, "http://test.int", "/", "", linkSource{}, 2, 0, 0)
+			if d.processed.Len() != tt.wantLen {
+				t.Errorf("Downloader.addURL() processed = %d, want %d", d.processed.Len(), tt.wantLen)
+			}
+			task := d.taskByURL(tt.url)
+			if task == nil {
+				t.Fatalf("Downloader.addURL() %s not added", tt.url)
+			}
+			if task.url != tt.wantURL {
+				t.Errorf("Downloader.addURL() url = %s, want %s", task.url, tt.wantURL)
+			}
+		})
+	}
+}
+
 func TestDownloader_runTaskNew(t *testing.T) {
 	ts := httptest.NewServer(testHandler())
 	defer ts.Close()
@@ -543,11 +503,10 @@ func TestDownloader_runTaskNew(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	p, ok := d.queue.Get()
+	ta, ok := d.queue.TryGet()
 	if !ok {
 		t.Fatal("Downloader.queue emphy")
 	}
-	ta := p.(*task)
 	if !d.runTask(ta) {
 		t.Fatal("Downloader.runTask() = false, want true")
 	}
@@ -555,11 +514,90 @@ func TestDownloader_runTaskNew(t *testing.T) {
 	verifyFile(t, d.outdir, ta.fileName, rootTpl, baseAddr)
 	n := 0
 	for {
-		p, ok = d.queue.Get()
+		ta, ok = d.queue.TryGet()
+		if !ok {
+			break
+		}
+		_, ok = urlQueue[ta.url]
+		if !ok {
+			t.Errorf("Downloader.runTask() queue unknown url '%s'", ta.url)
+		}
+		n++
+	}
+	if n != len(urlQueue) {
+		t.Fatalf("Downloader.runTask() produce queue len = %d, want %d", n, len(urlQueue))
+	}
+}
+
+func TestDownloader_runTaskRecheck(t *testing.T) {
+	ts := httptest.NewServer(testHandler())
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	baseAddr := "http://" + ts.Listener.Addr().String()
+	dir := tmpdir + "/" + "out"
+
+	d := NewDownloader(SiteDirMode, 1, time.Second, 2)
+
+	d.AddRootURL(baseAddr+"/index.html", 1, 0, 0)
+	urlQueue := map[string]bool{
+		baseAddr + "/style.css": true,
+		baseAddr + "/1.gif":     true,
+	}
+	// page content requeued with increased levels
+	urlRecheckQueue := map[string]bool{
+		baseAddr + "/style.css":      true,
+		baseAddr + "/1.gif":          true,
+		baseAddr + "/1.gz":           true,
+		baseAddr + "/link1.html":     true,
+		baseAddr + "/not_found.html": true,
+	}
+
+	_, err = d.NewLoad(dir, "godownloader.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, ok := d.queue.TryGet()
+	if !ok {
+		t.Fatal("Downloader.queue emphy")
+	}
+	if !d.runTask(root) {
+		t.Fatal("Downloader.runTask() = false, want true")
+	}
+	verifyQueue(t, d, urlQueue)
+
+	if root.NeedRecheck() {
+		t.Fatal("task.NeedRecheck() = true before levels changed")
+	}
+	if !root.UpdateLinks(2, 0, 0) {
+		t.Fatal("task.UpdateLinks() = false, want true")
+	}
+	if !root.NeedRecheck() {
+		t.Fatal("task.NeedRecheck() = false after levels changed")
+	}
+	if !d.runTask(root) {
+		t.Fatal("Downloader.runTask() recheck = false, want true")
+	}
+	if root.NeedRecheck() {
+		t.Fatal("task.NeedRecheck() = true after recheck")
+	}
+	verifyQueue(t, d, urlRecheckQueue)
+}
+
+func verifyQueue(t *testing.T, d *Downloader, urlQueue map[string]bool) {
+	n := 0
+	for {
+		ta, ok := d.queue.TryGet()
 		if !ok {
 			break
 		}
-		ta = p.(*task)
+		d.queue.Done(ta)
 		_, ok = urlQueue[ta.url]
 		if !ok {
 			t.Errorf("Downloader.runTask() queue unknown url '%s'", ta.url)
@@ -570,3 +608,92 @@ func TestDownloader_runTaskNew(t *testing.T) {
 		t.Fatalf("Downloader.runTask() produce queue len = %d, want %d", n, len(urlQueue))
 	}
 }
+
+func TestDownloader_runTaskUpdate(t *testing.T) {
+	content := []byte("GIF89a")
+	modTime := time.Date(2020, 8, 22, 6, 0, 0, 0, time.UTC)
+	etag := `"gif-v1"`
+	var status []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/robots.txt" {
+			http.NotFound(w, req)
+			return
+		}
+		rec := httptest.NewRecorder()
+		rec.Header().Set("ETag", etag)
+		http.ServeContent(rec, req, "1.gif", modTime, bytes.NewReader(content))
+		status = append(status, rec.Code)
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer ts.Close()
+
+	tmpdir, err := ioutil.TempDir("", "godownloader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	dir := tmpdir + "/" + "out"
+	d := NewDownloader(FlatMode, 1, time.Second, 2)
+	d.AddRootURL(ts.URL+"/1.gif", 1, 0, 0)
+	_, err = d.NewLoad(dir, "godownloader.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.closeMap()
+	d.update = true
+
+	tests := []struct {
+		name       string
+		etag       string
+		wantStatus int
+		wantData   string
+	}{
+		{"not modified", etag, http.StatusNotModified, "old"},
+		{"modified", `"gif-v0"`, http.StatusOK, string(content)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := newLoadTask(ts.URL+"/1.gif", "/", 1, 0, 0, 1)
+			task.fileName = "1.gif"
+			task.contentType = "image/gif"
+			task.status = TaskOK
+			task.etag = tt.etag
+			fileName := d.outdir + "/" + task.fileName
+			if err := ioutil.WriteFile(fileName, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			status = nil
+
+			if !d.runTask(task) {
+				t.Fatal("Downloader.runTask() = false, want true")
+			}
+			if len(status) != 1 || status[0] != tt.wantStatus {
+				t.Errorf("Downloader.runTask() http status = %v, want %d", status, tt.wantStatus)
+			}
+			if !task.Refreshed() {
+				t.Errorf("Downloader.runTask() task not refreshed")
+			}
+			result, err := ioutil.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.wantData {
+				t.Errorf("Downloader.runTask() file = '%s', want '%s'", string(result), tt.wantData)
+			}
+
+			// only one refresh in run
+			status = nil
+			if !d.runTask(task) {
+				t.Fatal("Downloader.runTask() = false, want true")
+			}
+			if len(status) != 0 {
+				t.Errorf("Downloader.runTask() refreshed twice")
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+<html>
+  <head>
+    <meta charset="utf-8">
+    <title>CSS</title>
+    <link rel="stylesheet" href="css/main.css" tppabs="{{ Host }}/css/main.css">
+    <style>
+h1 { background: url("img/Inline.png"); }
+</style>
+  </head>
+  <body>
+    <h1>CSS</h1>
+    <div style="Background-Image: url(img/attr.png); color: red">Style</div>
+    <p style="content: &#34;a  b&#34;;  background: url(&#34;img/a  b.png&#34;)">Quoted</p>
+  </body>
+</html>
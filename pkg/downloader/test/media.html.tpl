@@ -0,0 +1,27 @@
+<html>
+  <head>
+    <meta charset="utf-8">
+    <title>Media</title>
+  </head>
+  <body background="bg.gif" tppabs-background="{{ Host }}/bg.gif">
+    <h1>Media</h1>
+    <img src="1.gif" srcset="1.gif 1x, /img/1-2x.gif 2x" tppabs="{{ Host }}/1.gif" tppabs-srcset="{{ Host }}/1.gif 1x, {{ Host }}/img/1-2x.gif 2x">
+    <picture>
+      <source srcset="img/1.webp 480w,
+  img/1-large.webp 1080w" type="image/webp" tppabs-srcset="{{ Host }}/img/1.webp 480w, {{ Host }}/img/1-large.webp 1080w">
+      <img src="1.gif" tppabs="{{ Host }}/1.gif">
+    </picture>
+    <video src="video/1.mp4" poster="video/1.jpg" tppabs="{{ Host }}/video/1.mp4" tppabs-poster="{{ Host }}/video/1.jpg">
+      <source src="video/1.webm" type="video/webm" tppabs="{{ Host }}/video/1.webm">
+      <track src="video/1.vtt" kind="subtitles" tppabs="{{ Host }}/video/1.vtt">
+    </video>
+    <audio>
+      <source src="audio/1.ogg" type="audio/ogg" tppabs="{{ Host }}/audio/1.ogg">
+    </audio>
+    <object data="1.swf" type="application/x-shockwave-flash" tppabs="{{ Host }}/1.swf"></object>
+    <embed src="1.svg" type="image/svg+xml" tppabs="{{ Host }}/1.svg">
+    <input type="image" src="submit.gif" tppabs="{{ Host }}/submit.gif">
+    <input type="text" src="text.gif">
+    <img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" srcset="data:image/gif;base64,R0lGODlhAQABAAAAACw= 1x">
+  </body>
+</html>
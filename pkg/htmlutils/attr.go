@@ -0,0 +1,54 @@
+package htmlutils
+
+import (
+	"html"
+	"strings"
+)
+
+// RawAttribute return attribute value from original open tag (some attributes, like style, are normalized by html parser)
+func RawAttribute(openTag string, name string) (string, bool) {
+	s := strings.TrimPrefix(openTag, "<")
+	// skip tag name
+	i := strings.IndexAny(s, " \t\r\n\f/>")
+	if i == -1 {
+		return "", false
+	}
+	s = s[i:]
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t\r\n\f/")
+		if len(s) == 0 || s[0] == '>' {
+			break
+		}
+		i = strings.IndexAny(s, "= \t\r\n\f/>")
+		if i == -1 {
+			i = len(s)
+		}
+		attrName := s[0:i]
+		s = strings.TrimLeft(s[i:], " \t\r\n\f")
+		var value string
+		if len(s) > 0 && s[0] == '=' {
+			s = strings.TrimLeft(s[1:], " \t\r\n\f")
+			if len(s) > 0 && (s[0] == '"' || s[0] == '\'') {
+				end := strings.IndexByte(s[1:], s[0])
+				if end == -1 {
+					value = s[1:]
+					s = ""
+				} else {
+					value = s[1 : end+1]
+					s = s[end+2:]
+				}
+			} else {
+				end := strings.IndexAny(s, " \t\r\n\f>")
+				if end == -1 {
+					end = len(s)
+				}
+				value = s[0:end]
+				s = s[end:]
+			}
+		}
+		if strings.EqualFold(attrName, name) {
+			return html.UnescapeString(value), true
+		}
+	}
+	return "", false
+}
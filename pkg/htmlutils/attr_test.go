@@ -0,0 +1,30 @@
+package htmlutils
+
+import (
+	"testing"
+)
+
+func TestRawAttribute(t *testing.T) {
+	tests := []struct {
+		openTag string
+		name    string
+		want    string
+		wantOk  bool
+	}{
+		{`<div style="Background: URL('Img/BG.png')">`, "style", "Background: URL('Img/BG.png')", true},
+		{`<div class=a STYLE='color: red' id="x">`, "style", "color: red", true},
+		{`<div data-x="a &amp; b" style=color:red>`, "style", "color:red", true},
+		{`<input checked style="a:b"/>`, "style", "a:b", true},
+		{`<input checked style="a:b"/>`, "checked", "", true},
+		{`<div class="style=x">`, "style", "", false},
+		{`<br>`, "style", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.openTag, func(t *testing.T) {
+			got, ok := RawAttribute(tt.openTag, tt.name)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("RawAttribute() = ('%s', %v), want ('%s', %v)", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
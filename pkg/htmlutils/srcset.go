@@ -0,0 +1,80 @@
+package htmlutils
+
+import (
+	"strings"
+)
+
+// SrcsetCandidate image candidate from srcset attribute
+type SrcsetCandidate struct {
+	URL        string
+	Descriptor string // width (100w) or pixel density (2x) descriptor, may be blank
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// ParseSrcset parse srcset attribute to image candidates
+func ParseSrcset(srcset string) []SrcsetCandidate {
+	var candidates []SrcsetCandidate
+	i := 0
+	n := len(srcset)
+	for i < n {
+		// skip whitespace and commas before url
+		for i < n && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+		if i == n {
+			break
+		}
+		start := i
+		for i < n && !isSpace(srcset[i]) {
+			i++
+		}
+		url := srcset[start:i]
+		var descriptor string
+		if strings.HasSuffix(url, ",") {
+			// no descriptors
+			url = strings.TrimRight(url, ",")
+		} else {
+			start = i
+			inParens := false
+			for i < n {
+				c := srcset[i]
+				if c == '(' {
+					inParens = true
+				} else if c == ')' {
+					inParens = false
+				} else if c == ',' && !inParens {
+					break
+				}
+				i++
+			}
+			descriptor = strings.Join(strings.Fields(srcset[start:i]), " ")
+			if i < n {
+				// skip comma
+				i++
+			}
+		}
+		if len(url) > 0 {
+			candidates = append(candidates, SrcsetCandidate{URL: url, Descriptor: descriptor})
+		}
+	}
+	return candidates
+}
+
+// FormatSrcset format image candidates to srcset attribute
+func FormatSrcset(candidates []SrcsetCandidate) string {
+	var sb strings.Builder
+	for i := range candidates {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(candidates[i].URL)
+		if len(candidates[i].Descriptor) > 0 {
+			sb.WriteRune(' ')
+			sb.WriteString(candidates[i].Descriptor)
+		}
+	}
+	return sb.String()
+}
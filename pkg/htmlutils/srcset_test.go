@@ -0,0 +1,48 @@
+package htmlutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset     string
+		want       []SrcsetCandidate
+		wantFormat string
+	}{
+		{"img/1.png", []SrcsetCandidate{{"img/1.png", ""}}, "img/1.png"},
+		{
+			"img/1.png 1x, img/2.png 2x",
+			[]SrcsetCandidate{{"img/1.png", "1x"}, {"img/2.png", "2x"}},
+			"img/1.png 1x, img/2.png 2x",
+		},
+		{
+			"\n  img/small.jpg  480w,\n  img/large.jpg 1080w\n",
+			[]SrcsetCandidate{{"img/small.jpg", "480w"}, {"img/large.jpg", "1080w"}},
+			"img/small.jpg 480w, img/large.jpg 1080w",
+		},
+		{
+			"img/1.png, img/2.png 2x,",
+			[]SrcsetCandidate{{"img/1.png", ""}, {"img/2.png", "2x"}},
+			"img/1.png, img/2.png 2x",
+		},
+		{
+			"data:image/png;base64,iVBORw0KGgo= 1x, /img/a,b.png 2x",
+			[]SrcsetCandidate{{"data:image/png;base64,iVBORw0KGgo=", "1x"}, {"/img/a,b.png", "2x"}},
+			"data:image/png;base64,iVBORw0KGgo= 1x, /img/a,b.png 2x",
+		},
+		{"", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcset, func(t *testing.T) {
+			got := ParseSrcset(tt.srcset)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSrcset() = %+v, want %+v", got, tt.want)
+			}
+			if format := FormatSrcset(got); format != tt.wantFormat {
+				t.Errorf("FormatSrcset() = '%s', want '%s'", format, tt.wantFormat)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type rule struct {
+	allow bool
+	path  string
+}
+
+// Robots robots.txt rules for user agent
+type Robots struct {
+	rules      []rule
+	CrawlDelay time.Duration
+}
+
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// AllowAll return rules without restrictions (for missing robots.txt)
+func AllowAll() *Robots {
+	return &Robots{}
+}
+
+// agentMatch return match length of user agent token with group agent (-1 if not matched)
+func agentMatch(userAgent, agent string) int {
+	if agent == "*" {
+		return 0
+	}
+	if strings.Contains(userAgent, agent) {
+		return len(agent)
+	}
+	return -1
+}
+
+// Parse parse robots.txt and return rules for user agent
+func Parse(data []byte, userAgent string) *Robots {
+	var (
+		groups []*group
+		g      *group
+	)
+	userAgent = strings.ToLower(userAgent)
+	// product token (without version)
+	if i := strings.IndexAny(userAgent, "/ "); i > 0 {
+		userAgent = userAgent[0:i]
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	agentLine := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexRune(line, '#'); i != -1 {
+			line = line[0:i]
+		}
+		i := strings.IndexRune(line, ':')
+		if i == -1 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[0:i]))
+		value := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			if g == nil || !agentLine {
+				g = &group{}
+				groups = append(groups, g)
+			}
+			g.agents = append(g.agents, strings.ToLower(value))
+			agentLine = true
+		case "allow", "disallow":
+			agentLine = false
+			if g == nil {
+				continue
+			}
+			if value == "" {
+				// empty disallow - allow all
+				continue
+			}
+			g.rules = append(g.rules, rule{allow: key == "allow", path: value})
+		case "crawl-delay":
+			agentLine = false
+			if g == nil {
+				continue
+			}
+			if delay, err := strconv.ParseFloat(value, 64); err == nil && delay > 0 {
+				g.crawlDelay = time.Duration(delay * float64(time.Second))
+			}
+		default:
+			agentLine = false
+		}
+	}
+
+	var (
+		found *group
+		best  = -1
+	)
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if n := agentMatch(userAgent, agent); n > best {
+				found = g
+				best = n
+			}
+		}
+	}
+	if found == nil {
+		return AllowAll()
+	}
+	return &Robots{rules: found.rules, CrawlDelay: found.crawlDelay}
+}
+
+// pathMatch check if path matched pattern (with * and $ support)
+func pathMatch(path, pattern string) bool {
+	end := strings.HasSuffix(pattern, "$")
+	if end {
+		pattern = pattern[0 : len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if i == len(parts)-1 && end {
+			return strings.HasSuffix(path[pos:], parts[i])
+		}
+		n := strings.Index(path[pos:], parts[i])
+		if n == -1 {
+			return false
+		}
+		pos += n + len(parts[i])
+	}
+	if end && len(parts) == 1 {
+		return pos == len(path)
+	}
+	return true
+}
+
+// Allowed check path (with query) for access (longest match win, allow win for equal length)
+func (r *Robots) Allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	allow := true
+	matched := -1
+	for _, rule := range r.rules {
+		if pathMatch(path, rule.path) {
+			n := len(rule.path)
+			if n > matched || (n == matched && rule.allow) {
+				matched = n
+				allow = rule.allow
+			}
+		}
+	}
+	return allow
+}
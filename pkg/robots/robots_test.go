@@ -0,0 +1,65 @@
+package robots
+
+import (
+	"testing"
+	"time"
+)
+
+const robotsTxt = `# test robots
+User-agent: *
+Disallow: /private/
+Disallow: /*.iso$
+Allow: /private/public.html
+Crawl-delay: 2
+
+User-agent: godownloader
+User-agent: otherbot
+Disallow: /logout
+Disallow: /search?
+Crawl-delay: 0.5
+
+User-agent: badbot
+Disallow: /
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		userAgent  string
+		path       string
+		want       bool
+		crawlDelay time.Duration
+	}{
+		{"Mozilla/5.0", "/index.html", true, 2 * time.Second},
+		{"Mozilla/5.0", "/private/index.html", false, 2 * time.Second},
+		{"Mozilla/5.0", "/private/public.html", true, 2 * time.Second},
+		{"Mozilla/5.0", "/dist/1.iso", false, 2 * time.Second},
+		{"Mozilla/5.0", "/dist/1.iso.txt", true, 2 * time.Second},
+		{"godownloader/1.0", "/private/index.html", true, 500 * time.Millisecond},
+		{"godownloader/1.0", "/logout", false, 500 * time.Millisecond},
+		{"godownloader/1.0", "/search?q=1", false, 500 * time.Millisecond},
+		{"godownloader/1.0", "/search.html", true, 500 * time.Millisecond},
+		{"OtherBot", "/logout", false, 500 * time.Millisecond},
+		{"badbot", "/index.html", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.userAgent+" "+tt.path, func(t *testing.T) {
+			r := Parse([]byte(robotsTxt), tt.userAgent)
+			if got := r.Allowed(tt.path); got != tt.want {
+				t.Errorf("Robots.Allowed() = %v, want %v", got, tt.want)
+			}
+			if r.CrawlDelay != tt.crawlDelay {
+				t.Errorf("Robots.CrawlDelay = %v, want %v", r.CrawlDelay, tt.crawlDelay)
+			}
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	r := Parse([]byte("User-agent: *\nDisallow:\n"), "godownloader")
+	if !r.Allowed("/index.html") {
+		t.Errorf("Robots.Allowed() = false, want true")
+	}
+	if !AllowAll().Allowed("/") {
+		t.Errorf("AllowAll().Allowed() = false, want true")
+	}
+}
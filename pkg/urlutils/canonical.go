@@ -0,0 +1,92 @@
+package urlutils
+
+import (
+	neturl "net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Canonicalizer url canonicalization rules (for deduplicate urls)
+type Canonicalizer struct {
+	SortQuery    bool     // sort query params
+	StripParams  []string // strip query params (name or glob pattern, like utm_*)
+	IgnoreScheme bool     // treat http and https urls as same
+}
+
+// stripParam check if query param must be stripped
+func (c *Canonicalizer) stripParam(name string) bool {
+	for _, pattern := range c.StripParams {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// query return canonical query
+func (c *Canonicalizer) query(rawQuery string) string {
+	if len(rawQuery) == 0 || (!c.SortQuery && len(c.StripParams) == 0) {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	n := 0
+	for _, p := range params {
+		if len(p) == 0 {
+			continue
+		}
+		if len(c.StripParams) > 0 {
+			name := p
+			if i := strings.IndexByte(p, '='); i != -1 {
+				name = p[0:i]
+			}
+			if unescaped, err := neturl.QueryUnescape(name); err == nil {
+				name = unescaped
+			}
+			if c.stripParam(name) {
+				continue
+			}
+		}
+		params[n] = p
+		n++
+	}
+	params = params[0:n]
+	if c.SortQuery {
+		sort.SliceStable(params, func(i, k int) bool {
+			return queryName(params[i]) < queryName(params[k])
+		})
+	}
+	return strings.Join(params, "&")
+}
+
+func queryName(param string) string {
+	if i := strings.IndexByte(param, '='); i != -1 {
+		return param[0:i]
+	}
+	return param
+}
+
+// Canonical return canonical url without anchor (lowercase scheme and host, without default port, with query rules)
+func (c *Canonicalizer) Canonical(url string) string {
+	u, err := neturl.Parse(StripAnchor(strings.TrimSpace(url)))
+	if err != nil {
+		return StripAnchor(url)
+	}
+	u.Fragment = ""
+	if len(u.Host) > 0 && len(u.Path) == 0 {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+	u.RawQuery = c.query(u.RawQuery)
+	u.ForceQuery = false
+	return NormalizeURL(u)
+}
+
+// Key return key for deduplicate urls (canonical url, https scheme replaced with http, if scheme ignored)
+func (c *Canonicalizer) Key(url string) string {
+	url = c.Canonical(url)
+	if c.IgnoreScheme && strings.HasPrefix(url, "https://") {
+		return "http://" + url[8:]
+	}
+	return url
+}
@@ -0,0 +1,51 @@
+package urlutils
+
+import (
+	"testing"
+)
+
+func TestCanonicalizer_Canonical(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     Canonicalizer
+		url   string
+		want  string
+		wantK string
+	}{
+		{"host", Canonicalizer{}, "HTTP://Test.Int/a#1", "http://test.int/a", "http://test.int/a"},
+		{"port", Canonicalizer{}, "http://test.int:80/a", "http://test.int/a", "http://test.int/a"},
+		{"path", Canonicalizer{}, "http://test.int", "http://test.int/", "http://test.int/"},
+		{"query", Canonicalizer{}, "http://test.int/a?b=1&a=2", "http://test.int/a?b=1&a=2", "http://test.int/a?b=1&a=2"},
+		{"empty query", Canonicalizer{}, "http://test.int/a?", "http://test.int/a", "http://test.int/a"},
+		{
+			"sort query", Canonicalizer{SortQuery: true},
+			"http://test.int/a?b=1&a=2&a=1", "http://test.int/a?a=2&a=1&b=1", "http://test.int/a?a=2&a=1&b=1",
+		},
+		{
+			"strip params", Canonicalizer{StripParams: []string{"utm_*", "fbclid"}},
+			"http://test.int/a?utm_source=x&b=1&fbclid=2&utm%5Fmedium=y", "http://test.int/a?b=1", "http://test.int/a?b=1",
+		},
+		{
+			"strip all params", Canonicalizer{StripParams: []string{"utm_*"}},
+			"http://test.int/a?utm_source=x", "http://test.int/a", "http://test.int/a",
+		},
+		{
+			"ignore scheme", Canonicalizer{IgnoreScheme: true},
+			"https://test.int:443/a", "https://test.int/a", "http://test.int/a",
+		},
+		{
+			"scheme", Canonicalizer{},
+			"https://test.int/a", "https://test.int/a", "https://test.int/a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.Canonical(tt.url); got != tt.want {
+				t.Errorf("Canonicalizer.Canonical() = %v, want %v", got, tt.want)
+			}
+			if got := tt.c.Key(tt.url); got != tt.wantK {
+				t.Errorf("Canonicalizer.Key() = %v, want %v", got, tt.wantK)
+			}
+		})
+	}
+}
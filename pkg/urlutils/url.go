@@ -1,6 +1,7 @@
 package urlutils
 
 import (
+	neturl "net/url"
 	"strings"
 )
 
@@ -49,16 +50,96 @@ func SplitURLScheme(url string) (string, string, string) {
 	return scheme, url[p:i], url[i:]
 }
 
-// AbsURL check if url is absolute and if not, append base host
-func AbsURL(url string, baseHost string) string {
-	p := strings.Index(url, "://")
-	if p == -1 {
-		if len(url) > 0 && url[0] == '/' {
-			return baseHost + url
+// AbsURL resolve url relative to base (document) url by RFC 3986 and normalize it
+func AbsURL(url string, baseURL string) string {
+	url = strings.TrimSpace(url)
+	ref, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	if base, err := neturl.Parse(baseURL); err == nil {
+		ref = base.ResolveReference(ref)
+	}
+	return NormalizeURL(ref)
+}
+
+// NormalizeURL normalize http(s) url (lowercase host, strip default port, normalize percent-encoding)
+func NormalizeURL(u *neturl.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme != "http" && scheme != "https") || len(u.Host) == 0 {
+		return u.String()
+	}
+	var sb strings.Builder
+	sb.WriteString(scheme)
+	sb.WriteString("://")
+	if u.User != nil {
+		sb.WriteString(u.User.String())
+		sb.WriteRune('@')
+	}
+	host := strings.ToLower(u.Host)
+	if (scheme == "http" && strings.HasSuffix(host, ":80")) || (scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[0:strings.LastIndex(host, ":")]
+	} else if strings.HasSuffix(host, ":") {
+		host = host[0 : len(host)-1]
+	}
+	sb.WriteString(host)
+	sb.WriteString(normalizePercent(u.EscapedPath()))
+	if u.ForceQuery || len(u.RawQuery) > 0 {
+		sb.WriteRune('?')
+		sb.WriteString(normalizePercent(u.RawQuery))
+	}
+	if len(u.Fragment) > 0 {
+		// URL.EscapedFragment is not available before go 1.15
+		fragment := neturl.URL{Fragment: u.Fragment}
+		sb.WriteString(normalizePercent(fragment.String()))
+	}
+	return sb.String()
+}
+
+func isUnreserved(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// normalizePercent decode percent-encoded unreserved characters and uppercase other percent-encoded octets
+func normalizePercent(s string) string {
+	if strings.IndexByte(s, '%') == -1 {
+		return s
+	}
+	const upperhex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			h, ok1 := unhex(s[i+1])
+			l, ok2 := unhex(s[i+2])
+			if ok1 && ok2 {
+				c := h<<4 | l
+				if isUnreserved(c) {
+					sb.WriteByte(c)
+				} else {
+					sb.WriteByte('%')
+					sb.WriteByte(upperhex[h])
+					sb.WriteByte(upperhex[l])
+				}
+				i += 2
+				continue
+			}
 		}
-		return baseHost + "/" + url
+		sb.WriteByte(s[i])
 	}
-	return url
+	return sb.String()
 }
 
 // BaseURLDir strip filename defore last /
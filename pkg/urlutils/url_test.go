@@ -101,6 +101,41 @@ func TestAbsURL(t *testing.T) {
 	}
 }
 
+func TestAbsURL_Document(t *testing.T) {
+	baseURL := "http://test.int/docs/x/page.html?q=1"
+	tests := []struct {
+		url        string
+		wantAbsURL string
+	}{
+		{"../img/a.png", "http://test.int/docs/img/a.png"},
+		{"./a.html", "http://test.int/docs/x/a.html"},
+		{"a/../../b/./c.html", "http://test.int/docs/b/c.html"},
+		{"../../../../a.html", "http://test.int/a.html"},
+		{"//cdn.test.int/x.js", "http://cdn.test.int/x.js"},
+		{"?page=2", "http://test.int/docs/x/page.html?page=2"},
+		{"#top", "http://test.int/docs/x/page.html?q=1#top"},
+		{"#a b", "http://test.int/docs/x/page.html?q=1#a%20b"},
+		{"#x%2fy%7e", "http://test.int/docs/x/page.html?q=1#x/y~"},
+		{"", "http://test.int/docs/x/page.html?q=1"},
+		{" a.html ", "http://test.int/docs/x/a.html"},
+		{"HTTP://Test.INT:80/A.html", "http://test.int/A.html"},
+		{"https://test.int:443/", "https://test.int/"},
+		{"https://test.int:8443/", "https://test.int:8443/"},
+		{"http://test.int/%7euser/a%2fb%c3%a9.html", "http://test.int/~user/a%2Fb%C3%A9.html"},
+		{"a b.html", "http://test.int/docs/x/a%20b.html"},
+		{"mailto:user@test.int", "mailto:user@test.int"},
+		{"javascript:void(0)", "javascript:void(0)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			absURL := AbsURL(tt.url, baseURL)
+			if absURL != tt.wantAbsURL {
+				t.Errorf("AbsURL() got = %v, want %v", absURL, tt.wantAbsURL)
+			}
+		})
+	}
+}
+
 func TestBaseURLDir(t *testing.T) {
 	tests := []struct {
 		url  string